@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+)
+
+type ArchFrameworker struct {
+	t *template.Template
+	g *generator
+}
+
+const (
+	ArchInfo = `To complete building the package, invoke:
+    makepkg`
+
+	archPkgrel = "1"
+)
+
+// archNative is the list of architectures that a package which may
+// be compiled on "any" architecture is built for.
+var archNative = []string{"x86_64", "i686", "armv7h", "aarch64"}
+
+// archArchitectures maps Debian architecture names, which are used in
+// the Package, to their Arch Linux equivalents.
+var archArchitectures = map[string]string{
+	"amd64": "x86_64",
+	"i386":  "i686",
+	"armhf": "armv7h",
+	"arm64": "aarch64",
+}
+
+func (a ArchFrameworker) Info() string {
+	return ArchInfo
+}
+
+func (a ArchFrameworker) Framework(p *Package) (err error) {
+	// Begin by trying to load the templates.
+	a.t, err = loadTemplates("arch", "systemd")
+	if err != nil {
+		return
+	}
+	l.Debug("Loaded arch/*.template files")
+
+	p = p.resolveNames("arch")
+	a.g = newGenerator("arch")
+
+	l.Debug("Creating PKGBUILD\n")
+	pkgbuild, err := a.pkgbuild(p)
+	if err != nil {
+		return
+	}
+	err = a.execute("PKGBUILD", "PKGBUILD.template", pkgbuild)
+	if err != nil {
+		return
+	}
+
+	l.Debug("Creating .SRCINFO\n")
+	err = a.execute(".SRCINFO", "SRCINFO.template", pkgbuild)
+	if err != nil {
+		return
+	}
+	return a.g.Commit()
+}
+
+// pkgbuild creates an archPkgbuildFile from the given Package, and
+// uses the version control tags to determine the pkgver.
+func (a ArchFrameworker) pkgbuild(p *Package) (pkgbuild *archPkgbuildFile, err error) {
+	// First, check that all required fields are given.
+	if len(p.ProjectName) == 0 || len(p.Description) == 0 ||
+		len(p.Maintainer.Name) == 0 || len(p.Maintainer.Email) == 0 {
+		return nil, errors.New("arch: not all required fields are given; " +
+			"run 'sanepack lint' for details")
+	}
+
+	// The version is found in the same way as the debian changelog,
+	// but pkgver may not contain hyphens, and the Revision is given
+	// as the pkgrel.
+	ctx, err := newTemplateContext(p)
+	if err != nil {
+		return
+	}
+
+	pkgbuild = &archPkgbuildFile{
+		templateContext: ctx,
+		Name:            p.ProjectName,
+		Version:         strings.Replace(ctx.UpstreamVersion, "-", ".", -1),
+		Epoch:           p.Epoch,
+		Release:         archPkgrel,
+		Description:     p.Description,
+		Pkgdesc:         archQuote(p.Description),
+		URL:             p.Homepage,
+		Maintainer:      p.Maintainer,
+		Arch:            archArch(p.Architecture),
+		MakeDepends:     archRelations(p.BuildDepends),
+	}
+
+	if len(p.Revision) > 0 {
+		pkgbuild.Release = p.Revision
+	}
+
+	// Arch gives licenses as SPDX identifiers, and a package under
+	// several licenses at once lists each of them.
+	if p.Copyright != nil && len(p.Copyright.License) > 0 {
+		license, err := parseLicense(p.Copyright.License)
+		if err != nil {
+			return nil, fmt.Errorf("arch: invalid license %q: %s",
+				p.Copyright.License, err)
+		}
+		terms := []*licenseExpr{license}
+		if license.Op == "AND" {
+			terms = license.Terms
+		}
+		for _, term := range terms {
+			pkgbuild.License = append(pkgbuild.License, term.String())
+		}
+	}
+
+	var install []string
+	pkgbuild.Build, install, err = archBuildCommands(p)
+	if err != nil {
+		return
+	}
+
+	// If there is more than one binary package, this is a split
+	// package, and each has its own package_<name>() function.
+	binaries := p.Binaries()
+	pkgbuild.Split = len(binaries) > 1
+	for _, b := range binaries {
+		pkg, err := a.pkg(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		if !pkgbuild.Split {
+			pkgbuild.Arch = pkg.Arch
+		} else {
+			pkg.Indent = "\t"
+			if b.Architecture == p.Architecture {
+				pkg.Arch = nil
+			}
+		}
+		pkgbuild.Packages = append(pkgbuild.Packages, pkg)
+	}
+
+	// The project is installed by its build system into the package
+	// with the same name as the project, or the first if there is
+	// none.
+	if len(install) > 0 {
+		pkg := pkgbuild.Packages[0]
+		for _, candidate := range pkgbuild.Packages {
+			if candidate.Name == pkgbuild.Name {
+				pkg = candidate
+			}
+		}
+		pkg.Commands = install
+	}
+	return
+}
+
+// archBuildCommands returns the commands which build the project in
+// build() and install it into $pkgdir in package(), as described by
+// the Arch Linux package guidelines for its build system. The Build
+// and Install commands of the BuildOptions replace them.
+func archBuildCommands(p *Package) (build, install []string, err error) {
+	bs, err := findBuildSystem(p)
+	if err != nil {
+		return nil, nil, errors.New("arch: " + err.Error())
+	}
+	if bs != nil {
+		switch bs.Name {
+		case "cmake":
+			build = []string{"cmake -B build -S . -DCMAKE_BUILD_TYPE=None " +
+				"-DCMAKE_INSTALL_PREFIX=/usr", "cmake --build build"}
+			install = []string{`DESTDIR="$pkgdir" cmake --install build`}
+		case "meson":
+			build = []string{"arch-meson build", "meson compile -C build"}
+			install = []string{`meson install -C build --destdir "$pkgdir"`}
+		case "autotools":
+			if _, err := os.Stat("configure"); err != nil {
+				build = append(build, "autoreconf -fi")
+			}
+			build = append(build, "./configure --prefix=/usr", "make")
+			install = []string{`make DESTDIR="$pkgdir" install`}
+		case "cargo":
+			build = []string{"cargo build --release"}
+		case "python":
+			build = []string{"python -m build --wheel --no-isolation"}
+			install = []string{
+				`python -m installer --destdir="$pkgdir" dist/*.whl`}
+		case "make":
+			// Not every Makefile has an install target.
+			build = []string{"make"}
+			install = []string{"if make -n install >/dev/null 2>&1; " +
+				`then make DESTDIR="$pkgdir" install; fi`}
+		case "go":
+			// The version is set in the same way as in debian/rules.
+			command, version := goCommand()
+			gobuild := "go build -trimpath"
+			if version {
+				gobuild += ` -ldflags "-X main.Version=$pkgver"`
+			}
+			if command {
+				gobuild += " -o " + p.ProjectName + " ."
+			} else {
+				gobuild += " -o ./ ./..."
+			}
+			build = []string{`export GOCACHE="$srcdir/.gocache"`, gobuild}
+		}
+	}
+
+	if p.Build != nil {
+		if len(p.Build.Build) > 0 {
+			build = p.Build.Build
+		}
+		if len(p.Build.Install) > 0 {
+			install = append([]string{`export DESTDIR="$pkgdir"`},
+				p.Build.Install...)
+		}
+	}
+	return
+}
+
+// pkg creates an archPackage from the given binary package.
+func (a ArchFrameworker) pkg(ctx templateContext, b *BinaryPackage) (pkg *archPackage, err error) {
+	pkg = &archPackage{
+		Name:        b.Name,
+		Description: b.Description,
+		Pkgdesc:     archQuote(b.Description),
+		Arch:        archArch(b.Architecture),
+		Depends:     archRelations(b.Depends),
+		Conflicts:   archRelations(b.Conflicts),
+		Provides:    archRelations(b.Provides),
+		Replaces:    archRelations(b.Replaces),
+		Docs:        b.Docs,
+	}
+
+	// Arch has no distinction between Recommends and Suggests; both
+	// become optdepends.
+	pkg.OptDepends = archRelations(append(
+		append([]Relation{}, b.Recommends...), b.Suggests...))
+
+	// Each Install line is a source path or glob and a target
+	// directory, which is created in package().
+	for _, line := range b.Install {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			l.Debugf("Skipping malformed install line %q\n", line)
+			continue
+		}
+		pkg.Install = append(pkg.Install,
+			archInstall{fields[0], strings.Trim(fields[1], "/")})
+	}
+
+	// Manpages are installed into the section directory matching
+	// their extension.
+	for _, page := range b.ManPages {
+		target := path.Join("usr/share/man",
+			"man"+strings.TrimPrefix(path.Ext(page), "."), path.Base(page))
+		pkg.ManPages = append(pkg.ManPages, archInstall{page, target})
+	}
+
+	// systemd units are installed from their files, if given, or
+	// otherwise written out in package(). Arch packages do not enable
+	// their units.
+	for _, s := range b.Services {
+		unit := archUnit{Target: s.Unit(b.Name), Source: s.File}
+		if len(s.File) == 0 {
+			unit.Contents, err = s.Contents(a.t, ctx)
+			if err != nil {
+				return nil, err
+			}
+		}
+		pkg.Units = append(pkg.Units, unit)
+	}
+	return
+}
+
+// PackageNames returns the names of every package in the PKGBUILD.
+func (a *archPkgbuildFile) PackageNames() (names []string) {
+	for _, pkg := range a.Packages {
+		names = append(names, pkg.Name)
+	}
+	return
+}
+
+// execute creates the named file and executes the named template
+// into it.
+func (a ArchFrameworker) execute(filename, name string, data interface{}) (err error) {
+	f, err := a.g.Create(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	return a.t.ExecuteTemplate(f, name, data)
+}
+
+// archArch converts a Debian architecture to the Arch arch array.
+// "all" packages are architecture independent, "any" packages may be
+// built for every native architecture, and anything else restricts
+// the package to that architecture.
+func archArch(architecture string) []string {
+	switch architecture {
+	case "all":
+		return []string{"any"}
+	case "any", "":
+		return archNative
+	}
+	arch, ok := archArchitectures[architecture]
+	if !ok {
+		arch = architecture
+	}
+	return []string{arch}
+}
+
+// archQuote escapes any single quotes in the given string, so that it
+// can be placed in single quotes in the PKGBUILD.
+func archQuote(s string) string {
+	return strings.Replace(s, "'", `'\''`, -1)
+}
+
+// archRelations converts a slice of Relations to their Arch
+// equivalents, such that "libc6 (>= 2.3)" becomes "libc6>=2.3". Arch
+// has no notion of alternatives, so only the first is kept, and a
+// warning is given for the others. As in RPM, architecture qualifiers
+// and restrictions and build profiles are dropped.
+func archRelations(relations []Relation) (converted []string) {
+	for _, relation := range relations {
+		if len(relation.Alternatives) > 0 {
+			l.Warningf("arch: alternatives are not supported, so only "+
+				"%q of %q is kept\n", relation.Choices()[0], relation)
+		}
+		name, op := relation.Package(), relation.Op
+		switch op {
+		case "":
+			converted = append(converted, name)
+			continue
+		case ">>":
+			op = ">"
+		case "<<":
+			op = "<"
+		}
+		converted = append(converted, name+op+relation.Version)
+	}
+	return
+}
+
+type archInstall struct {
+	Source, Target string
+}
+
+type archUnit struct {
+	Source, Target, Contents string
+}
+
+type archPkgbuildFile struct {
+	templateContext
+	Name, Version, Release, Description, URL string
+	Pkgdesc                                  string
+	Epoch                                    int
+	Split                                    bool
+	Maintainer                               Person
+	Arch, License, MakeDepends, Build        []string
+	Packages                                 []*archPackage
+}
+
+type archPackage struct {
+	Name, Description, Pkgdesc, Indent string
+	Arch, Depends, OptDepends          []string
+	Conflicts, Provides, Replaces      []string
+	Docs, Commands                     []string
+	Install, ManPages                  []archInstall
+	Units                              []archUnit
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A buildSystem is a way of building a project, such as CMake, which
+// can be detected from the files at the top of the project.
+type buildSystem struct {
+	// Name is the name by which the build system is given in
+	// BuildOptions.System, such as "cmake."
+	Name string
+
+	// Files are the names of the files which mark a project as using
+	// the build system, any one of which must be present.
+	Files []string
+
+	// Debhelper is the debhelper build system which builds the
+	// project, as passed to dh with --buildsystem. If it is empty,
+	// the project is built by overriding the dh_auto_* targets.
+	Debhelper string
+
+	// With is the debhelper addon which the build system requires, if
+	// any, as passed to dh with --with.
+	With string
+}
+
+// buildSystems are the known build systems, in the order in which they
+// are detected. Projects often have files for more than one, such as a
+// Makefile generated by configure or wrapping "go build," so the one
+// which is most likely to drive the others is detected first.
+var buildSystems = []*buildSystem{
+	{Name: "cmake", Files: []string{"CMakeLists.txt"}, Debhelper: "cmake"},
+	{Name: "meson", Files: []string{"meson.build"}, Debhelper: "meson"},
+	{Name: "autotools", Files: []string{"configure.ac", "configure.in", "configure"},
+		Debhelper: "autoconf"},
+	{Name: "cargo", Files: []string{"Cargo.toml"}},
+	{Name: "python", Files: []string{"pyproject.toml", "setup.py", "setup.cfg"},
+		Debhelper: "pybuild", With: "python3"},
+	{Name: "make", Files: []string{"GNUmakefile", "makefile", "Makefile"},
+		Debhelper: "makefile"},
+	{Name: "go", Files: []string{"go.mod"}},
+}
+
+// goVersionVar matches the declaration of a Version variable in a Go
+// source file, which may be set at link time with -X main.Version.
+var goVersionVar = regexp.MustCompile(`(?m)^(?:var)?\s+Version(?:\s+string)?\s*(?:=|$)`)
+
+// goMainPackage matches the package clause of a Go command.
+var goMainPackage = regexp.MustCompile(`(?m)^package main\s*$`)
+
+// findBuildSystem returns the build system given in the BuildOptions
+// of the Package, or otherwise the one detected from the files in the
+// current directory. Go projects which have no go.mod, and so are
+// built in GOPATH mode, are detected from their source files. If no
+// build system is found, it returns nil.
+func findBuildSystem(p *Package) (*buildSystem, error) {
+	if p.Build != nil && len(p.Build.System) > 0 {
+		for _, bs := range buildSystems {
+			if bs.Name == p.Build.System {
+				return bs, nil
+			}
+		}
+		return nil, errors.New("unknown build system " + p.Build.System +
+			"; run 'sanepack lint' for details")
+	}
+
+	for _, bs := range buildSystems {
+		for _, file := range bs.Files {
+			if _, err := os.Stat(file); err == nil {
+				l.Debugf("Found %s build system from %q\n", bs.Name, file)
+				return bs, nil
+			}
+		}
+	}
+	if sources, _ := filepath.Glob("*.go"); len(sources) > 0 {
+		l.Debug("Found go build system from source files\n")
+		return buildSystems[len(buildSystems)-1], nil
+	}
+	return nil, nil
+}
+
+// goCommand inspects the Go source files in the current directory, and
+// reports whether they make up a command, and whether that command
+// declares a Version variable in which the version can be set when it
+// is linked.
+func goCommand() (command, version bool) {
+	sources, _ := filepath.Glob("*.go")
+	for _, source := range sources {
+		if strings.HasSuffix(source, "_test.go") {
+			continue
+		}
+		contents, err := os.ReadFile(source)
+		if err != nil || !goMainPackage.Match(contents) {
+			continue
+		}
+		command = true
+		if goVersionVar.Match(contents) {
+			version = true
+		}
+	}
+	return
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// changelogIgnore is the list of Conventional Commit types which are
+// left out of the changelog if ChangelogOptions.Ignore is not given.
+var changelogIgnore = []string{"chore", "ci", "docs"}
+
+// changelogTitles are the titles of the sections into which
+// Conventional Commits are grouped, in the order in which they appear.
+// Types which are not listed are grouped under changelogOther.
+var changelogTitles = []struct{ Type, Title string }{
+	{"feat", "Features"},
+	{"fix", "Bug fixes"},
+	{"perf", "Performance improvements"},
+	{"revert", "Reverts"},
+}
+
+const (
+	changelogBreaking = "Breaking changes"
+	changelogOther    = "Other changes"
+)
+
+var (
+	// changelogSubject matches the subject line of a Conventional
+	// Commit, such as "feat(parser)!: add arrays."
+	changelogSubject = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?: *(.+)$`)
+
+	// changelogBreakingFooter matches the footer which marks a
+	// breaking change.
+	changelogBreakingFooter = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+
+	// changelogCloses matches trailers which close bugs, such as
+	// "Closes: #123, #456," in the form which dpkg recognizes in a
+	// Debian changelog, and captures the list of bugs. Other trailers,
+	// such as "Fixes:," name commits rather than bugs.
+	changelogCloses = regexp.MustCompile(`(?mi)^closes:\s*((?:bug)?#?\s?\d+(?:,\s*(?:bug)?#?\s?\d+)*)\.?\s*$`)
+
+	// changelogBug matches a single bug number in a trailer.
+	changelogBug = regexp.MustCompile(`\d+`)
+)
+
+// A changelogSection is a group of changes of the same kind, such as
+// features or bug fixes. If commits are not grouped, there is a single
+// section with no Title.
+type changelogSection struct {
+	Title   string
+	Changes []string
+}
+
+// changelogSections reads the commits made after the release tagged
+// since and up to the release tagged until, such as "v0.1" and "v0.2,"
+// and returns the changes they make. Either may be empty, as for
+// vcs.Log. If the Package asks for Conventional Commits, the changes
+// are grouped into sections, noise is dropped, and closed bugs are
+// noted.
+func changelogSections(p *Package, since, until string) (sections []*changelogSection, err error) {
+	if p.Changelog == nil || !p.Changelog.Conventional {
+		changes, err := vcsChanges(since, until)
+		if err != nil || len(changes) == 0 {
+			return nil, err
+		}
+		return []*changelogSection{{Changes: changes}}, nil
+	}
+
+	commits, err := vcsCommits(since, until)
+	if err != nil {
+		return
+	}
+	ignore := p.Changelog.Ignore
+	if ignore == nil {
+		ignore = changelogIgnore
+	}
+	return conventionalSections(commits, ignore), nil
+}
+
+// conventionalSections groups the changes made by Conventional Commits
+// into sections, in the order of changelogTitles, with breaking
+// changes first and other changes last. Sections without changes are
+// left out.
+func conventionalSections(commits []vcsCommit, ignore []string) (sections []*changelogSection) {
+	grouped := make(map[string][]string)
+	for _, commit := range commits {
+		title, change, ok := conventionalChange(commit, ignore)
+		if ok {
+			grouped[title] = append(grouped[title], change)
+		}
+	}
+
+	titles := []string{changelogBreaking}
+	for _, t := range changelogTitles {
+		titles = append(titles, t.Title)
+	}
+	titles = append(titles, changelogOther)
+	for _, title := range titles {
+		if len(grouped[title]) > 0 {
+			sections = append(sections,
+				&changelogSection{title, grouped[title]})
+		}
+	}
+	return
+}
+
+// conventionalChange parses a commit as a Conventional Commit, and
+// returns the title of the section it belongs in and the change to
+// list. Commits of ignored types are not listed, unless they are
+// breaking changes, and commits which are not Conventional Commits are
+// listed as other changes.
+func conventionalChange(commit vcsCommit, ignore []string) (title, change string, ok bool) {
+	title, change = changelogOther, commit.Subject
+	if m := changelogSubject.FindStringSubmatch(commit.Subject); m != nil {
+		kind := strings.ToLower(m[1])
+		change = m[4]
+		if len(m[2]) > 0 {
+			change = m[2] + ": " + change
+		}
+		for _, t := range changelogTitles {
+			if t.Type == kind {
+				title = t.Title
+			}
+		}
+		switch {
+		case len(m[3]) > 0 || changelogBreakingFooter.MatchString(commit.Body):
+			title = changelogBreaking
+		case contains(ignore, kind):
+			return "", "", false
+		}
+	}
+
+	// Bugs closed by the commit are noted as in Debian changelogs, so
+	// that they are closed when the package is uploaded.
+	var bugs []string
+	for _, trailer := range changelogCloses.FindAllStringSubmatch(commit.Body, -1) {
+		for _, bug := range changelogBug.FindAllStringSubmatch(trailer[1], -1) {
+			bugs = append(bugs, "#"+bug[0])
+		}
+	}
+	if len(bugs) > 0 {
+		change += " (Closes: " + concat(", ", bugs...) + ")"
+	}
+	return title, change, true
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConventionalChange(t *testing.T) {
+	tests := []struct {
+		commit vcsCommit
+		title  string
+		change string
+		ok     bool
+	}{
+		{vcsCommit{"feat: add arrays", ""}, "Features", "add arrays", true},
+		{vcsCommit{"FIX: crash", ""}, "Bug fixes", "crash", true},
+		{vcsCommit{"feat(parser): add arrays", ""}, "Features", "parser: add arrays", true},
+		{vcsCommit{"refactor: tidy", ""}, changelogOther, "tidy", true},
+		{vcsCommit{"Tidy up", ""}, changelogOther, "Tidy up", true},
+		{vcsCommit{"chore: bump", ""}, "", "", false},
+		{vcsCommit{"chore!: drop Go 1.10", ""}, changelogBreaking, "drop Go 1.10", true},
+		{
+			vcsCommit{"feat: new config", "Details.\n\nBREAKING CHANGE: old keys are gone\n"},
+			changelogBreaking, "new config", true,
+		},
+		{
+			vcsCommit{"fix: crash", "Closes: #123, #456\n"},
+			"Bug fixes", "crash (Closes: #123, #456)", true,
+		},
+		{
+			vcsCommit{"fix: crash", "closes: bug#12,bug 34.\nCloses: 56\n"},
+			"Bug fixes", "crash (Closes: #12, #34, #56)", true,
+		},
+		{
+			// Other trailers name commits, not bugs.
+			vcsCommit{"fix: crash", "Fixes: 1234abcd (\"feat: add arrays\")\n"},
+			"Bug fixes", "crash", true,
+		},
+		{
+			// Closes: must be a trailer of its own.
+			vcsCommit{"fix: crash", "This Closes: #1 in passing.\n"},
+			"Bug fixes", "crash", true,
+		},
+	}
+	for _, test := range tests {
+		title, change, ok := conventionalChange(test.commit, changelogIgnore)
+		if title != test.title || change != test.change || ok != test.ok {
+			t.Errorf("conventionalChange(%q) = %q, %q, %t, want %q, %q, %t",
+				test.commit, title, change, ok, test.title, test.change, test.ok)
+		}
+	}
+}
+
+func TestConventionalSections(t *testing.T) {
+	commits := []vcsCommit{
+		{"fix: crash", ""},
+		{"docs: typo", ""},
+		{"feat: arrays", ""},
+		{"Update README", ""},
+		{"feat!: drop v1 config", ""},
+		{"feat: maps", ""},
+	}
+	want := []*changelogSection{
+		{changelogBreaking, []string{"drop v1 config"}},
+		{"Features", []string{"arrays", "maps"}},
+		{"Bug fixes", []string{"crash"}},
+		{changelogOther, []string{"Update README"}},
+	}
+	sections := conventionalSections(commits, changelogIgnore)
+	if !reflect.DeepEqual(sections, want) {
+		t.Errorf("conventionalSections() = %s, want %s",
+			sectionsString(sections), sectionsString(want))
+	}
+
+	// With nothing ignored, types such as "docs" are other changes.
+	sections = conventionalSections(commits[1:2], []string{})
+	want = []*changelogSection{{changelogOther, []string{"typo"}}}
+	if !reflect.DeepEqual(sections, want) {
+		t.Errorf("conventionalSections() = %s, want %s",
+			sectionsString(sections), sectionsString(want))
+	}
+}
+
+// sectionsString formats sections for test failures.
+func sectionsString(sections []*changelogSection) (s string) {
+	for _, section := range sections {
+		s += section.Title + ": " + concat("; ", section.Changes...) + "\n"
+	}
+	return
+}
@@ -0,0 +1,624 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DebianBuilder assembles a .deb archive directly, in the same format
+// that dpkg-deb would produce, so that neither dpkg-buildpackage nor
+// debhelper are needed.
+type DebianBuilder struct {
+	t *template.Template
+}
+
+const (
+	debianBinaryVersion = "2.0\n"
+)
+
+// debianArchitectures maps GOARCH values to Debian architecture
+// names, and is used to determine the architecture of packages which
+// may be built on "any" architecture.
+var debianArchitectures = map[string]string{
+	"amd64":    "amd64",
+	"386":      "i386",
+	"arm":      "armhf",
+	"arm64":    "arm64",
+	"ppc64le":  "ppc64el",
+	"s390x":    "s390x",
+	"mips64le": "mips64el",
+	"riscv64":  "riscv64",
+}
+
+// debianInitScripts are the maintainer script snippets which register
+// and start an init script, as debhelper's dh_installinit would
+// produce. Each is formatted with the name of the init script.
+var debianInitScripts = map[string]string{
+	"postinst": `if [ "$1" = "configure" ] || [ "$1" = "abort-upgrade" ]; then
+	if [ -x "/etc/init.d/%[1]s" ]; then
+		update-rc.d %[1]s defaults >/dev/null
+		invoke-rc.d %[1]s start || exit 1
+	fi
+fi
+`,
+	"prerm": `if [ -x "/etc/init.d/%[1]s" ] && [ "$1" = remove ]; then
+	invoke-rc.d %[1]s stop || exit 1
+fi
+`,
+	"postrm": `if [ "$1" = "purge" ] ; then
+	update-rc.d %[1]s remove >/dev/null
+fi
+`,
+}
+
+// debianSystemdScripts are the maintainer script snippets which
+// enable, start, and stop a systemd unit, as debhelper's
+// dh_installsystemd would produce. Each is formatted with the name of
+// the unit. The "-enable" snippets are omitted if the unit should not
+// be enabled on install, and the "-restart" snippets are used in
+// place of the "-start" snippets unless it should not be restarted
+// on upgrade.
+var debianSystemdScripts = map[string]string{
+	"postinst-enable": `if [ "$1" = "configure" ] || [ "$1" = "abort-upgrade" ]; then
+	deb-systemd-helper unmask '%[1]s' >/dev/null || true
+	# was-enabled defaults to true, so new installations run enable.
+	if deb-systemd-helper --quiet was-enabled '%[1]s'; then
+		deb-systemd-helper enable '%[1]s' >/dev/null || true
+	else
+		deb-systemd-helper update-state '%[1]s' >/dev/null || true
+	fi
+fi
+`,
+	"postinst-restart": `if [ "$1" = "configure" ] || [ "$1" = "abort-upgrade" ]; then
+	if [ -d /run/systemd/system ]; then
+		systemctl --system daemon-reload >/dev/null || true
+		if [ -n "$2" ]; then
+			deb-systemd-invoke restart '%[1]s' >/dev/null || true
+		else
+			deb-systemd-invoke start '%[1]s' >/dev/null || true
+		fi
+	fi
+fi
+`,
+	"postinst-start": `if [ "$1" = "configure" ] || [ "$1" = "abort-upgrade" ]; then
+	if [ -d /run/systemd/system ]; then
+		systemctl --system daemon-reload >/dev/null || true
+		if [ -z "$2" ]; then
+			deb-systemd-invoke start '%[1]s' >/dev/null || true
+		fi
+	fi
+fi
+`,
+	"prerm": `if [ -d /run/systemd/system ] && [ "$1" = remove ]; then
+	deb-systemd-invoke stop '%[1]s' >/dev/null || true
+fi
+`,
+	"postrm": `if [ -d /run/systemd/system ]; then
+	systemctl --system daemon-reload >/dev/null || true
+fi
+if [ "$1" = "remove" ] && [ -x "/usr/bin/deb-systemd-helper" ]; then
+	deb-systemd-helper mask '%[1]s' >/dev/null || true
+fi
+if [ "$1" = "purge" ] && [ -x "/usr/bin/deb-systemd-helper" ]; then
+	deb-systemd-helper purge '%[1]s' >/dev/null || true
+	deb-systemd-helper unmask '%[1]s' >/dev/null || true
+fi
+`,
+}
+
+func (d DebianBuilder) Build(p *Package) (filenames []string, err error) {
+	// Begin by trying to load the templates.
+	d.t, err = loadTemplates("debian", "systemd")
+	if err != nil {
+		return
+	}
+	l.Debug("Loaded debian/*.template files")
+
+	p = p.resolveNames("deb")
+	version, err := debianVersion(p)
+	if err != nil {
+		return
+	}
+
+	// The control files are created from the same fields as
+	// debian/control, with one .deb built for each binary package.
+	control, err := newDebianControlFile(p)
+	if err != nil {
+		return
+	}
+	for i, b := range p.Binaries() {
+		binary := control.Binaries[i]
+		binary.Version = version
+
+		filename, err := d.binary(binary, b, p)
+		if err != nil {
+			return nil, err
+		}
+		filenames = append(filenames, filename)
+	}
+	return
+}
+
+// binary builds the .deb for a single binary package, and returns
+// the name of the file it was written to.
+func (d DebianBuilder) binary(control *debianBinaryControl, b *BinaryPackage, p *Package) (filename string, err error) {
+	// Packages which may be built on "any" architecture are built for
+	// the current one.
+	if control.Architecture == "any" {
+		arch, ok := debianArchitectures[runtime.GOARCH]
+		if !ok {
+			return "", fmt.Errorf("debian: unknown architecture %q",
+				runtime.GOARCH)
+		}
+		control.Architecture = arch
+	}
+
+	// Next, assemble the data archive from the files which will be
+	// installed.
+	l.Debugf("Creating data.tar.gz for %s\n", b.Name)
+	data := newDebianArchive()
+	err = d.data(data, control.Source.templateContext, b)
+	if err != nil {
+		return
+	}
+	err = data.Close()
+	if err != nil {
+		return
+	}
+	control.InstalledSize = (data.size + 1023) / 1024
+
+	// Then, the control archive, which must be created after the
+	// data archive so that the md5sums and size are known.
+	l.Debugf("Creating control.tar.gz for %s\n", b.Name)
+	controlArchive := newDebianArchive()
+	err = d.controlArchive(controlArchive, control, data, b)
+	if err != nil {
+		return
+	}
+	err = controlArchive.Close()
+	if err != nil {
+		return
+	}
+
+	// Finally, write the ar archive, which contains the format
+	// version followed by the two archives. The epoch is not part
+	// of the filename.
+	version := control.Version
+	if i := strings.Index(version, ":"); i >= 0 {
+		version = version[i+1:]
+	}
+	filename = fmt.Sprintf("%s_%s_%s.deb",
+		b.Name, version, control.Architecture)
+	l.Debugf("Creating %s\n", filename)
+	f, err := os.Create(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	now := time.Now()
+	_, err = io.WriteString(f, "!<arch>\n")
+	if err != nil {
+		return
+	}
+	err = writeArEntry(f, "debian-binary", []byte(debianBinaryVersion), now)
+	if err != nil {
+		return
+	}
+	err = writeArEntry(f, "control.tar.gz", controlArchive.Bytes(), now)
+	if err != nil {
+		return
+	}
+	err = writeArEntry(f, "data.tar.gz", data.Bytes(), now)
+	return
+}
+
+// data populates the data archive from the Install, Docs, ManPages,
+// and InitScript fields of the binary package, along with the
+// copyright and changelog.
+func (d DebianBuilder) data(a *debianArchive, ctx templateContext, b *BinaryPackage) (err error) {
+	p := ctx.Package
+
+	// Each Install line is a source path or glob and a target
+	// directory.
+	for _, line := range b.Install {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("debian: malformed install line %q", line)
+		}
+		matches, err := filepath.Glob(fields[0])
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("debian: %q matches no files", fields[0])
+		}
+		for _, match := range matches {
+			err = a.AddTree(match, path.Join(fields[1], filepath.Base(match)))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	docdir := path.Join("usr/share/doc", b.Name)
+	for _, doc := range b.Docs {
+		err = a.AddFile(doc, path.Join(docdir, filepath.Base(doc)), 0644)
+		if err != nil {
+			return
+		}
+	}
+
+	// The copyright and changelog are rendered from the same
+	// templates as debian/copyright and debian/changelog.
+	if p.Copyright != nil {
+		c, err := newDebianCopyrightFile(ctx)
+		if err != nil {
+			return err
+		}
+		buf := new(bytes.Buffer)
+		err = d.t.ExecuteTemplate(buf, "copyright.template", c)
+		if err != nil {
+			return err
+		}
+		err = a.AddBytes(path.Join(docdir, "copyright"), buf.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	changelog, err := newDebianChangelogFile(p)
+	if err != nil {
+		return
+	}
+	buf := new(bytes.Buffer)
+	err = d.t.ExecuteTemplate(buf, "changelog.template", changelog)
+	if err != nil {
+		return
+	}
+	name := debianChangelogName(debianFullVersion(p, ctx.UpstreamVersion))
+	err = a.AddBytes(path.Join(docdir, name), gzipBytes(buf.Bytes()), 0644)
+	if err != nil {
+		return
+	}
+
+	// Manpages are compressed and installed into the section
+	// directory matching their extension, as dh_installman would.
+	for _, page := range b.ManPages {
+		contents, err := os.ReadFile(page)
+		if err != nil {
+			return err
+		}
+		target := path.Join("usr/share/man",
+			"man"+strings.TrimPrefix(path.Ext(page), "."),
+			filepath.Base(page)+".gz")
+		err = a.AddBytes(target, gzipBytes(contents), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(b.InitScript) > 0 {
+		err = a.AddFile(b.InitScript,
+			path.Join("etc/init.d", b.Name), 0755)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, s := range b.Services {
+		contents, err := s.Contents(d.t, ctx)
+		if err != nil {
+			return err
+		}
+		err = a.AddBytes(path.Join("lib/systemd/system", s.Unit(b.Name)),
+			[]byte(contents), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return
+}
+
+// controlArchive populates the control archive with the control file,
+// md5sums, conffiles, and any maintainer scripts.
+func (d DebianBuilder) controlArchive(a *debianArchive, control *debianBinaryControl, data *debianArchive, b *BinaryPackage) (err error) {
+	buf := new(bytes.Buffer)
+	err = d.t.ExecuteTemplate(buf, "binarycontrol.template", control)
+	if err != nil {
+		return
+	}
+	err = a.AddBytes("control", buf.Bytes(), 0644)
+	if err != nil {
+		return
+	}
+
+	err = a.AddBytes("md5sums", []byte(concat("", data.sums...)), 0644)
+	if err != nil {
+		return
+	}
+
+	if len(data.conffiles) > 0 {
+		err = a.AddBytes("conffiles",
+			[]byte(concat("", data.conffiles...)), 0644)
+		if err != nil {
+			return
+		}
+	}
+
+	// The maintainer scripts are created as they would be in
+	// debian/, and the #DEBHELPER# token is replaced with the
+	// snippets which register, start, and stop the init script and
+	// systemd units, if there are any. If there are snippets but no
+	// maintainer script, one is created for the snippets alone.
+	scripts := debianMaintainerScripts(b)
+	snippets := debianSnippets(b)
+	for _, script := range debianScripts {
+		if scripts[script] == nil && len(snippets[script]) == 0 {
+			continue
+		}
+		var contents string
+		contents, err = debianScript(d.t, control.Source.templateContext,
+			b, script, scripts[script])
+		if err != nil {
+			return
+		}
+		contents = strings.Replace(contents, debianHelperToken,
+			snippets[script], 1)
+
+		err = a.AddBytes(script, []byte(contents), 0755)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// debianSnippets returns the maintainer script snippets for the init
+// script and systemd units of the given binary package, indexed by
+// the name of the maintainer script.
+func debianSnippets(b *BinaryPackage) map[string]string {
+	snippets := make(map[string]string, len(debianScripts))
+	if len(b.InitScript) > 0 {
+		for script, snippet := range debianInitScripts {
+			snippets[script] += fmt.Sprintf(snippet, b.Name)
+		}
+	}
+
+	for _, s := range b.Services {
+		unit := s.Unit(b.Name)
+		if !s.NoEnable {
+			snippets["postinst"] += fmt.Sprintf(
+				debianSystemdScripts["postinst-enable"], unit)
+		}
+		if s.NoRestart {
+			snippets["postinst"] += fmt.Sprintf(
+				debianSystemdScripts["postinst-start"], unit)
+		} else {
+			snippets["postinst"] += fmt.Sprintf(
+				debianSystemdScripts["postinst-restart"], unit)
+		}
+		snippets["prerm"] += fmt.Sprintf(debianSystemdScripts["prerm"], unit)
+		snippets["postrm"] += fmt.Sprintf(debianSystemdScripts["postrm"], unit)
+	}
+	return snippets
+}
+
+// debianArchive is a gzipped tar archive in the layout expected by
+// dpkg, in which every file is owned by root and every entry is
+// relative to "./". It also tracks the md5sums, conffiles, and
+// installed size of the regular files added to it.
+type debianArchive struct {
+	bytes.Buffer
+	gz *gzip.Writer
+	tw *tar.Writer
+
+	dirs      map[string]bool
+	sums      []string
+	conffiles []string
+	size      int64
+	mtime     time.Time
+}
+
+func newDebianArchive() (a *debianArchive) {
+	a = &debianArchive{
+		dirs:  make(map[string]bool),
+		mtime: time.Now(),
+	}
+	a.gz = gzip.NewWriter(&a.Buffer)
+	a.tw = tar.NewWriter(a.gz)
+	return
+}
+
+// Close flushes the tar and gzip streams. The archive's contents are
+// complete only after Close has been called.
+func (a *debianArchive) Close() (err error) {
+	err = a.tw.Close()
+	if err != nil {
+		return
+	}
+	return a.gz.Close()
+}
+
+// AddDir adds the given directory, and any of its parents which have
+// not yet been added.
+func (a *debianArchive) AddDir(name string) (err error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if a.dirs[name] {
+		return
+	}
+	if len(name) > 0 {
+		err = a.AddDir(path.Dir(name))
+		if err != nil {
+			return
+		}
+	}
+	a.dirs[name] = true
+
+	entry := "./"
+	if len(name) > 0 {
+		entry += name + "/"
+	}
+	return a.tw.WriteHeader(&tar.Header{
+		Name:     entry,
+		Typeflag: tar.TypeDir,
+		Mode:     0755,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  a.mtime,
+	})
+}
+
+// AddBytes adds a regular file with the given name, contents, and
+// mode, creating any parent directories.
+func (a *debianArchive) AddBytes(name string, contents []byte, mode int64) (err error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	err = a.AddDir(path.Dir(name))
+	if err != nil {
+		return
+	}
+	err = a.tw.WriteHeader(&tar.Header{
+		Name:     "./" + name,
+		Typeflag: tar.TypeReg,
+		Mode:     mode,
+		Size:     int64(len(contents)),
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  a.mtime,
+	})
+	if err != nil {
+		return
+	}
+	_, err = a.tw.Write(contents)
+	if err != nil {
+		return
+	}
+
+	a.sums = append(a.sums, fmt.Sprintf("%x  %s\n", md5.Sum(contents), name))
+	if strings.HasPrefix(name, "etc/") {
+		a.conffiles = append(a.conffiles, "/"+name+"\n")
+	}
+	a.size += int64(len(contents))
+	return
+}
+
+// AddFile adds the contents of the file at source to the archive as
+// name, with the given mode. If mode is 0, it is chosen based on
+// whether the source file is executable.
+func (a *debianArchive) AddFile(source, name string, mode int64) (err error) {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return
+	}
+	if mode == 0 {
+		mode = 0644
+		if fi.Mode()&0111 != 0 {
+			mode = 0755
+		}
+	}
+	contents, err := os.ReadFile(source)
+	if err != nil {
+		return
+	}
+	return a.AddBytes(name, contents, mode)
+}
+
+// AddSymlink adds a symbolic link with the given name, pointing to
+// target, creating any parent directories.
+func (a *debianArchive) AddSymlink(name, target string) (err error) {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	err = a.AddDir(path.Dir(name))
+	if err != nil {
+		return
+	}
+	return a.tw.WriteHeader(&tar.Header{
+		Name:     "./" + name,
+		Typeflag: tar.TypeSymlink,
+		Linkname: target,
+		Mode:     0777,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  a.mtime,
+	})
+}
+
+// AddTree adds the file or directory at source to the archive as
+// name. Directories are added recursively, and symbolic links are
+// added as they are, rather than followed.
+func (a *debianArchive) AddTree(source, name string) (err error) {
+	return filepath.Walk(source, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+		target := path.Join(name, filepath.ToSlash(rel))
+		switch {
+		case fi.IsDir():
+			return a.AddDir(target)
+		case fi.Mode().IsRegular():
+			return a.AddFile(file, target, 0)
+		case fi.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(file)
+			if err != nil {
+				return err
+			}
+			return a.AddSymlink(target, link)
+		default:
+			return errors.New("debian: cannot package special file " + file)
+		}
+	})
+}
+
+// debianChangelogName returns the name under which the changelog of
+// a package of the given version is installed. Debian policy requires
+// packages which are not native, whose versions have a revision, to
+// install it as "changelog.Debian.gz."
+func debianChangelogName(version string) string {
+	if strings.Contains(version, "-") {
+		return "changelog.Debian.gz"
+	}
+	return "changelog.gz"
+}
+
+// writeArEntry writes a single member of an ar archive, padded to an
+// even length, with root ownership.
+func writeArEntry(w io.Writer, name string, contents []byte, mtime time.Time) (err error) {
+	_, err = fmt.Fprintf(w, "%-16s%-12d%-6d%-6d%-8o%-10d`\n",
+		name, mtime.Unix(), 0, 0, 0100644, len(contents))
+	if err != nil {
+		return
+	}
+	_, err = w.Write(contents)
+	if err != nil {
+		return
+	}
+	if len(contents)%2 != 0 {
+		_, err = io.WriteString(w, "\n")
+	}
+	return
+}
+
+// gzipBytes compresses the given bytes at the best compression level,
+// as is expected for documentation and manpages.
+func gzipBytes(contents []byte) []byte {
+	buf := new(bytes.Buffer)
+	gz, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	gz.Write(contents)
+	gz.Close()
+	return buf.Bytes()
+}
@@ -1,12 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"path"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -14,14 +15,28 @@ import (
 
 type DebianFrameworker struct {
 	t *template.Template
+	g *generator
 }
 
+// debianScripts are the names of the maintainer scripts, in the order
+// in which they are created.
+var debianScripts = []string{"preinst", "postinst", "prerm", "postrm"}
+
 const (
 	DebianInfo = `To complete building the package, invoke:
-    dpkg-buildpackage`
-
-	debianStandardsVersion = "3.9.3"
-	debianCompatVersion    = "8"
+    dpkg-buildpackage
+or, to build it without dpkg-buildpackage:
+    sanepack build`
+
+	// debianStandardsVersion is the version of Debian Policy which the
+	// generated packages follow.
+	debianStandardsVersion = "4.7.2"
+	debianHelperToken      = "#DEBHELPER#"
+
+	// debianCompatLevel is the debhelper compatibility level used if
+	// none is given in the Package. It must be at least 11 for dh to
+	// run dh_installsystemd.
+	debianCompatLevel = 13
 )
 
 func (d DebianFrameworker) Info() string {
@@ -30,124 +45,145 @@ func (d DebianFrameworker) Info() string {
 
 func (d DebianFrameworker) Framework(p *Package) (err error) {
 	// Begin by trying to load the templates.
-	d.t, err = template.ParseGlob(path.Join(*fTemp, "debian", "*.template"))
+	d.t, err = loadTemplates("debian", "systemd")
 	if err != nil {
 		return
 	}
 	l.Debug("Loaded debian/*.template files")
 
-	l.Debug("Creating debian/ directory\n")
-	err = os.Mkdir("debian", 0777)
+	// Every template is given the Package, with its logical package
+	// names resolved, and the values computed from it.
+	p = p.resolveNames("deb")
+	ctx, err := newTemplateContext(p)
 	if err != nil {
 		return
 	}
 
+	// Files are written only once all have been generated, so that
+	// any edits to an existing debian/ directory can be merged.
+	d.g = newGenerator("debian")
+
 	l.Debug("Creating debain/changelog\n")
-	err = d.changelog(p.ProjectName, p.Maintainer)
+	err = d.changelog(p)
 	if err != nil {
 		return
 	}
 
 	l.Debug("Creating debian/control\n")
-	err = d.control(p.ProjectName, p.Description, "",
-		p.Section, p.Priority,
-		p.Homepage, p.Architecture, p.Maintainer, p.BuildDepends, p.Depends,
-		p.Recommends, p.Suggests, p.Conflicts, p.Provides, p.Replaces)
+	err = d.control(p)
 	if err != nil {
 		return
 	}
 
-	l.Debug("Creating debian/compat\n")
-	err = d.compat()
+	l.Debug("Creating debian/copyright\n")
+	copyright, err := newDebianCopyrightFile(ctx)
 	if err != nil {
 		return
 	}
-
-	l.Debug("Creating debian/copyright\n")
-	err = d.copyright(*p.Copyright, p.Homepage)
+	err = d.execute("debian/copyright", 0666, "copyright.template", copyright)
 	if err != nil {
 		return
 	}
 
 	l.Debug("Creating debian/rules\n")
-	err = d.rules()
+	err = d.rules(ctx)
 	if err != nil {
 		return
 	}
 
-	if len(p.Docs) > 0 {
-		l.Debug("Creating debian/docs\n")
-		err = d.docs(p.Docs)
+	// Each binary package has its own docs, init script, install,
+	// and manpages files.
+	for _, b := range p.Binaries() {
+		err = d.binary(ctx, b)
 		if err != nil {
 			return
 		}
-	} else {
-		l.Debug("Skpped debian/docs\n")
 	}
 
-	if len(p.InitScript) > 0 {
-		l.Debugf("Creating debian/%s.init\n", p.ProjectName)
-		err = d.initscript(p.ProjectName, p.InitScript)
+	l.Debug("Writing debian/ directory\n")
+	return d.g.Commit()
+}
+
+// binary creates the "debian/<name>.*" files which list the files
+// belonging to the given binary package.
+func (d DebianFrameworker) binary(ctx templateContext, b *BinaryPackage) (err error) {
+	// The docs, install, and manpages files are rendered from
+	// templates of the same names.
+	file := &debianBinaryFile{ctx, b}
+	if len(b.Docs) > 0 {
+		l.Debugf("Creating debian/%s.docs\n", b.Name)
+		err = d.execute("debian/"+b.Name+".docs", 0666, "docs.template", file)
 		if err != nil {
 			return
 		}
 	} else {
-		l.Debugf("Skipped debian/%s.init\n", p.ProjectName)
+		l.Debugf("Skipped debian/%s.docs\n", b.Name)
 	}
 
-	if len(p.Install) > 0 {
-		l.Debug("Creating debian/install\n")
-		err = d.install(p.Install)
+	if len(b.InitScript) > 0 {
+		l.Debugf("Creating debian/%s.init\n", b.Name)
+		err = d.initscript(b.Name, b.InitScript)
 		if err != nil {
 			return
 		}
 	} else {
-		l.Debug("Skipped debian/install\n")
+		l.Debugf("Skipped debian/%s.init\n", b.Name)
 	}
 
-	l.Debugf("Creating debian/%s.manpages\n", p.ProjectName)
-	err = d.manpages(p.ProjectName, p.ManPages)
-	if err != nil {
-		return
+	for _, s := range b.Services {
+		l.Debugf("Creating debian/%s.%s\n", b.Name, s.Unit(b.Name))
+		err = d.service(ctx, b.Name, s)
+		if err != nil {
+			return
+		}
+	}
+
+	scripts := debianMaintainerScripts(b)
+	for _, script := range debianScripts {
+		if scripts[script] == nil {
+			continue
+		}
+		l.Debugf("Creating debian/%s.%s\n", b.Name, script)
+		err = d.maintscript(ctx, b, script, scripts[script])
+		if err != nil {
+			return
+		}
+	}
+
+	if len(b.Install) > 0 {
+		l.Debugf("Creating debian/%s.install\n", b.Name)
+		err = d.execute("debian/"+b.Name+".install", 0666,
+			"install.template", file)
+		if err != nil {
+			return
+		}
+	} else {
+		l.Debugf("Skipped debian/%s.install\n", b.Name)
 	}
 
+	if len(b.ManPages) > 0 {
+		l.Debugf("Creating debian/%s.manpages\n", b.Name)
+		err = d.execute("debian/"+b.Name+".manpages", 0666,
+			"manpages.template", file)
+		if err != nil {
+			return
+		}
+	} else {
+		l.Debugf("Skipped debian/%s.manpages\n", b.Name)
+	}
 	return
 }
 
 // changelog creates a debian/changelog and reads the version control
-// changelog in order to populate it.
-func (d DebianFrameworker) changelog(name string, maintainer Person) (err error) {
-	// First, read the log to get a list of changes.
-	logoutput, err := exec.Command(
-		"git", "--no-pager", "log", "--simplify-merges",
-		"--pretty=format:%s").Output()
+// tags and log in order to populate it.
+func (d DebianFrameworker) changelog(p *Package) (err error) {
+	changelog, err := newDebianChangelogFile(p)
 	if err != nil {
 		return
 	}
 
-	// Second, use git describe to get the tag, and only the tag.
-	tag, err := exec.Command(
-		"git", "describe", "--abbrev=0", "--tags", "--match=v*").Output()
-	if err != nil {
-		return
-	}
-	// The Version is slightly more finnicky than the tag; it must
-	// start with a decimal number, and we must make sure not to
-	// include the final newline from the command. Thus, we trim "\n"
-	// from the right and "v" or "V" from the left.
-	version := strings.TrimLeft(
-		strings.TrimRight(string(tag), "\n"), "vV")
-
-	changelog := &debianChangelogFile{
-		Name:       name,
-		Version:    version,
-		Date:       time.Now().Format(time.RFC1123Z),
-		Maintainer: maintainer,
-		Changes:    strings.Split(string(logoutput), "\n"),
-	}
-
 	// Now, create and open debian/changelog for writing.
-	f, err := os.Create("debian/changelog")
+	f, err := d.g.Create("debian/changelog")
 	if err != nil {
 		return
 	}
@@ -157,61 +193,78 @@ func (d DebianFrameworker) changelog(name string, maintainer Person) (err error)
 	return d.t.ExecuteTemplate(f, "changelog.template", changelog)
 }
 
-// control creates a debian/control file and populates it with the
-// given fields. name, description, section, priority, architecture,
-// maintainer, buildDepends, and depends are required.
-func (d DebianFrameworker) control(name, description, longDescription, section, priority, homepage, architecture string, maintainer Person, buildDepends, depends, recommends, suggests, conflicts, provides, replaces []string) (err error) {
-
-	// First, check that all required fields are given.
-	if len(name) == 0 || len(description) == 0 || len(section) == 0 ||
-		len(priority) == 0 || len(architecture) == 0 ||
-		len(maintainer.Name) == 0 || len(maintainer.Email) == 0 ||
-		buildDepends == nil || depends == nil {
-		return errors.New("debian: not all required fields are given")
-	}
-
-	// Next, create a debianControlFile object.
-	control := &debianControlFile{
-		Name:             name,
-		Section:          section,
-		Priority:         priority,
-		Architecture:     architecture,
-		StandardsVersion: debianStandardsVersion,
-		Homepage:         homepage,
-		Description:      description,
-		LongDescription:  longDescription,
-		Maintainer:       maintainer,
-		BuildDepends:     concat(", ", buildDepends...),
-		Depends:          concat(", ", append(depends, "debhelper")...),
-		Recommends:       concat(", ", recommends...),
-		Suggests:         concat(", ", suggests...),
-		Conflicts:        concat(", ", conflicts...),
-		Provides:         concat(", ", provides...),
-		Replaces:         concat(", ", replaces...),
-		Include:          make(map[string]bool, 6),
-	}
-
-	if len(homepage) != 0 {
-		control.Include["Homepage"] = true
+// newDebianChangelogFile creates a debianChangelogFile object with one
+// entry for each release, from the version control tags. If there are
+// changes since the last release, or the Version is given and differs
+// from it, the newest entry is for the current version, and is signed
+// by the Maintainer and dated by the current commit.
+func newDebianChangelogFile(p *Package) (changelog *debianChangelogFile, err error) {
+	ctx, err := newTemplateContext(p)
+	if err != nil {
+		return
+	}
+	version := ctx.UpstreamVersion
+	releases, err := vcsReleases()
+	if err != nil {
+		return
 	}
-	if len(recommends) != 0 {
-		control.Include["Recommends"] = true
+
+	changelog = &debianChangelogFile{templateContext: ctx, Name: p.ProjectName}
+	if len(releases) == 0 || releases[0].Version != version {
+		var since string
+		if len(releases) > 0 {
+			since = releases[0].Tag
+		}
+		sections, err := changelogSections(p, since, "")
+		if err != nil {
+			return nil, err
+		}
+		changelog.Entries = append(changelog.Entries,
+			newDebianChangelogEntry(p, version, ctx.Date, p.Maintainer,
+				sections))
 	}
-	if len(suggests) != 0 {
-		control.Include["Suggests"] = true
+
+	for _, release := range releases {
+		author := release.Author
+		if len(author.Name) == 0 || len(author.Email) == 0 {
+			author = p.Maintainer
+		}
+		sections, err := changelogSections(p, release.Since, release.Tag)
+		if err != nil {
+			return nil, err
+		}
+		changelog.Entries = append(changelog.Entries,
+			newDebianChangelogEntry(p, release.Version, release.Date,
+				author, sections))
 	}
-	if len(conflicts) != 0 {
-		control.Include["Conflicts"] = true
+	return
+}
+
+// newDebianChangelogEntry creates a single changelog entry for the
+// given upstream version. Every entry must list at least one change,
+// so if there were no commits, the release itself is listed.
+func newDebianChangelogEntry(p *Package, version string, date time.Time, maintainer Person, sections []*changelogSection) *debianChangelogEntry {
+	if len(sections) == 0 {
+		sections = []*changelogSection{{Changes: []string{"Release " + version}}}
 	}
-	if len(provides) != 0 {
-		control.Include["Provides"] = true
+	return &debianChangelogEntry{
+		Version:    debianFullVersion(p, version),
+		Date:       date.Format(time.RFC1123Z),
+		Maintainer: maintainer,
+		Sections:   sections,
 	}
-	if len(replaces) != 0 {
-		control.Include["Replaces"] = true
+}
+
+// control creates a debian/control file and populates it with a
+// source stanza and one stanza for each binary package.
+func (d DebianFrameworker) control(p *Package) (err error) {
+	control, err := newDebianControlFile(p)
+	if err != nil {
+		return
 	}
 
 	// Attempt to open debian/control.
-	f, err := os.Create("debian/control")
+	f, err := d.g.Create("debian/control")
 	if err != nil {
 		return
 	}
@@ -222,54 +275,233 @@ func (d DebianFrameworker) control(name, description, longDescription, section,
 	return
 }
 
-// compat creats a "debian/compat" file using the global compat
-// version.
-func (d DebianFrameworker) compat() (err error) {
-	// Begin by trying to open the debian/compat file.
-	f, err := os.Create("debian/compat")
+// newDebianControlFile creates a debianControlFile object from the
+// given Package. ProjectName, Section, Priority, Maintainer, and
+// BuildDepends are required, as are the Name, Description,
+// Architecture, and Depends of every binary package.
+func newDebianControlFile(p *Package) (control *debianControlFile, err error) {
+	// First, check that all required fields are given.
+	if len(p.ProjectName) == 0 || len(p.Section) == 0 ||
+		len(p.Priority) == 0 ||
+		len(p.Maintainer.Name) == 0 || len(p.Maintainer.Email) == 0 ||
+		p.BuildDepends == nil {
+		return nil, errors.New("debian: not all required fields are given; " +
+			"run 'sanepack lint' for details")
+	}
+
+	ctx, err := newTemplateContext(p)
 	if err != nil {
 		return
 	}
-	defer f.Close()
 
-	// Now, write in the contents.
-	fmt.Fprintln(f, debianCompatVersion)
+	// Next, create a debianControlFile object for the source stanza.
+	control = &debianControlFile{
+		templateContext:  ctx,
+		Name:             p.ProjectName,
+		Section:          p.Section,
+		Priority:         p.Priority,
+		StandardsVersion: debianStandardsVersion,
+		Homepage:         p.Homepage,
+		Maintainer:       p.Maintainer,
+		BuildDepends:     debianRelations(debianBuildDepends(p)),
+		Include:          make(map[string]bool, 1),
+	}
+
+	if len(p.Homepage) != 0 {
+		control.Include["Homepage"] = true
+	}
+
+	// Owners other than the Maintainer, who are not only upstream
+	// authors, may also upload the package.
+	var uploaders []string
+	for _, owner := range p.ProjectOwners {
+		if !owner.Is(p.Maintainer) && owner.Role != "upstream" &&
+			len(owner.Email) > 0 {
+			uploaders = append(uploaders, owner.String())
+		}
+	}
+	if len(uploaders) > 0 {
+		control.Uploaders = concat(", ", uploaders...)
+		control.Include["Uploaders"] = true
+	}
+
+	// Then, add a stanza for each binary package.
+	for _, b := range p.Binaries() {
+		binary, err := newDebianBinaryControl(control, b)
+		if err != nil {
+			return nil, err
+		}
+		control.Binaries = append(control.Binaries, binary)
+	}
 	return
 }
 
-// copyright creates a "debian/copyright" file using the given license
-// type.
-func (d DebianFrameworker) copyright(c Copyright, homepage string) (err error) {
-	// Begin by trying to open the debian/copyright file.
-	f, err := os.Create("debian/copyright")
+// debianBuildDepends returns the BuildDepends of the Package, preceded
+// by "debhelper-compat (= N)," which sets the debhelper compatibility
+// level, unless it is already given. The given slice is not modified.
+func debianBuildDepends(p *Package) []Relation {
+	for _, r := range p.BuildDepends {
+		if r.Name == "debhelper-compat" {
+			return p.BuildDepends
+		}
+	}
+	compat := p.DebhelperCompat
+	if compat == 0 {
+		compat = debianCompatLevel
+	}
+	return append([]Relation{{
+		Name:    "debhelper-compat",
+		Op:      "=",
+		Version: strconv.Itoa(compat),
+	}}, p.BuildDepends...)
+}
+
+// newDebianBinaryControl creates a debianBinaryControl object for
+// the given binary package, as part of the given source.
+func newDebianBinaryControl(source *debianControlFile, b *BinaryPackage) (binary *debianBinaryControl, err error) {
+	if len(b.Name) == 0 || len(b.Description) == 0 ||
+		len(b.Architecture) == 0 || b.Depends == nil {
+		return nil, errors.New("debian: not all required fields are given for binary package " + b.Name)
+	}
+
+	binary = &debianBinaryControl{
+		Source:          source,
+		Name:            b.Name,
+		Architecture:    b.Architecture,
+		Description:     b.Description,
+		LongDescription: debianDescription(b.LongDescription),
+		Depends:         debianRelations(b.Depends),
+		Recommends:      debianRelations(b.Recommends),
+		Suggests:        debianRelations(b.Suggests),
+		Conflicts:       debianRelations(b.Conflicts),
+		Provides:        debianRelations(b.Provides),
+		Replaces:        debianRelations(b.Replaces),
+		Include:         make(map[string]bool, 5),
+	}
+
+	if len(b.Recommends) != 0 {
+		binary.Include["Recommends"] = true
+	}
+	if len(b.Suggests) != 0 {
+		binary.Include["Suggests"] = true
+	}
+	if len(b.Conflicts) != 0 {
+		binary.Include["Conflicts"] = true
+	}
+	if len(b.Provides) != 0 {
+		binary.Include["Provides"] = true
+	}
+	if len(b.Replaces) != 0 {
+		binary.Include["Replaces"] = true
+	}
+	return
+}
+
+// debianVersion returns the full version of the Debian package, made
+// up of the epoch, the upstream version, and the revision, such as
+// "1:1.2.0-1." Without a revision, the package is a native package.
+func debianVersion(p *Package) (version string, err error) {
+	version, err = p.UpstreamVersion()
 	if err != nil {
 		return
 	}
-	defer f.Close()
+	return debianFullVersion(p, version), nil
+}
 
-	c.Homepage = homepage
+// debianFullVersion adds the epoch and revision of the Package to the
+// given upstream version.
+func debianFullVersion(p *Package, version string) string {
+	if p.Epoch > 0 {
+		version = strconv.Itoa(p.Epoch) + ":" + version
+	}
+	if len(p.Revision) > 0 {
+		version += "-" + p.Revision
+	}
+	return version
+}
 
-	// If the file is opened properly, run it through
-	// d.t.ExecuteTemplate() and return any errors.
-	return d.t.ExecuteTemplate(f, "copyright.template", c)
+// debianMaintainerScripts returns the maintainer scripts of the given
+// binary package which are set, indexed by their Debian names.
+func debianMaintainerScripts(b *BinaryPackage) map[string]*Script {
+	scripts := make(map[string]*Script, len(debianScripts))
+	for script, s := range map[string]*Script{
+		"preinst":  b.PreInst,
+		"postinst": b.PostInst,
+		"prerm":    b.PreRm,
+		"postrm":   b.PostRm,
+	} {
+		if s != nil {
+			scripts[script] = s
+		}
+	}
+	return scripts
 }
 
-// docs creates a "debian/docs" file containing every given path to a
-// non-manpage document, one per line.
-func (d DebianFrameworker) docs(documents []string) (err error) {
-	// Begin by opening the file.
-	f, err := os.Create("debian/docs")
-	if err != nil {
+// debianScript creates the contents of the named maintainer script of
+// the binary package, with the #DEBHELPER# token in place so that
+// debhelper can add its own snippets. Inline snippets, or none if s is
+// nil, are placed in a script rendered from "maintscript.template,"
+// and script files have the token inserted before their final "exit
+// 0," or at the end, if it is not already present.
+func debianScript(t *template.Template, ctx templateContext, b *BinaryPackage, script string, s *Script) (contents string, err error) {
+	if s == nil || len(s.File) == 0 {
+		file := &debianScriptFile{templateContext: ctx, Binary: b, Script: script}
+		if s != nil {
+			file.Inline = strings.TrimRight(s.Inline, "\n")
+		}
+		buf := new(bytes.Buffer)
+		err = t.ExecuteTemplate(buf, "maintscript.template", file)
+		return buf.String(), err
+	}
+
+	contents, err = s.Contents()
+	if err != nil || strings.Contains(contents, debianHelperToken) {
 		return
 	}
-	defer f.Close()
+	lines := strings.Split(strings.TrimRight(contents, "\n"), "\n")
+	last := lines[len(lines)-1]
+	if strings.TrimSpace(last) == "exit 0" {
+		lines = append(lines[:len(lines)-1], debianHelperToken, "", last)
+	} else {
+		lines = append(lines, "", debianHelperToken)
+	}
+	return concat("\n", lines...) + "\n", nil
+}
 
-	// Now use fmt.Fprintln() to populate it.
-	for _, document := range documents {
-		fmt.Fprintln(f, document)
+// debianText formats multiple lines of text as the continuation lines
+// of a field in a Debian control or copyright file. Unlike
+// debianDescription, lines are not wrapped. Every line begins with a
+// space, blank lines are replaced with " .", and every line ends with
+// a newline.
+func debianText(text string) (formatted string) {
+	if len(strings.TrimSpace(text)) == 0 {
+		return
 	}
+	for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if len(line) == 0 {
+			line = "."
+		}
+		formatted += " " + line + "\n"
+	}
+	return
+}
 
-	f.Close()
+// debianDescription formats a long description for use in a control
+// file. Every line begins with a space, blank lines are replaced with
+// " .", and lines are wrapped at 80 columns. Every line, including the
+// last, ends with a newline. If there is no long description, the
+// result is empty.
+func debianDescription(long string) (formatted string) {
+	if len(strings.TrimSpace(long)) == 0 {
+		return
+	}
+	for _, line := range wrap(long, 79) {
+		if len(line) == 0 {
+			line = "."
+		}
+		formatted += " " + line + "\n"
+	}
 	return
 }
 
@@ -283,7 +515,7 @@ func (d DebianFrameworker) initscript(name, initscript string) (err error) {
 	}
 	defer fi.Close()
 	// If that succeeds, open the debian/<name>.init file.
-	fo, err := os.Create("debian/" + name + ".init")
+	fo, err := d.g.Create("debian/" + name + ".init")
 	if err != nil {
 		return
 	}
@@ -294,77 +526,355 @@ func (d DebianFrameworker) initscript(name, initscript string) (err error) {
 	return
 }
 
-// install creates a "debian/install" file containing every set of
-// paths in the slice, one element per line.
-func (d DebianFrameworker) install(paths []string) (err error) {
-	// Begin by trying to open the debian/install file.
-	f, err := os.Create("debian/install")
+// maintscript creates an executable "debian/<name>.<script>" file,
+// such as "debian/<name>.postinst," from the given Script.
+func (d DebianFrameworker) maintscript(ctx templateContext, b *BinaryPackage, script string, s *Script) (err error) {
+	contents, err := debianScript(d.t, ctx, b, script, s)
+	if err != nil {
+		return
+	}
+
+	// Create the file with the executable permission set.
+	f, err := d.g.CreateMode("debian/"+b.Name+"."+script, 0755)
 	if err != nil {
 		return
 	}
 	defer f.Close()
 
-	// If it opened properly, print in the paths.
-	for _, l := range paths {
-		fmt.Fprintln(f, l)
+	_, err = io.WriteString(f, contents)
+	return
+}
+
+// rules creates an executable "debian/rules" file, which builds the
+// project with its build system, and overrides dh_installsystemd if
+// there are any systemd units, so that each is installed under its own
+// name and with its own options.
+func (d DebianFrameworker) rules(ctx templateContext) (err error) {
+	rules, err := newDebianRulesFile(ctx)
+	if err != nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, b := range ctx.Package.Binaries() {
+		for _, s := range b.Services {
+			// Units with the same name, such as "foo.service" and
+			// "foo.socket," are installed by the same invocation.
+			name, _ := debianUnitName(b.Name, s)
+			args := "-p" + b.Name + " --name=" + name
+			if seen[args] {
+				continue
+			}
+			seen[args] = true
+
+			if s.NoEnable {
+				args += " --no-enable"
+			}
+			if s.NoRestart {
+				args += " --no-restart-after-upgrade"
+			}
+			rules.Systemd = append(rules.Systemd, args)
+		}
+	}
+
+	// Create the debian/rules file with the executable permission
+	// set.
+	return d.execute("debian/rules", 0777, "rules.template", rules)
+}
+
+// newDebianRulesFile creates a debianRulesFile which builds the project
+// with the build system found for it. Build systems which debhelper
+// knows are passed to dh, and the others are built by overriding the
+// dh_auto_* targets. Build and install commands given in the Package
+// replace those of the build system.
+func newDebianRulesFile(ctx templateContext) (rules *debianRulesFile, err error) {
+	p := ctx.Package
+	rules = &debianRulesFile{templateContext: ctx}
+	bs, err := findBuildSystem(p)
+	if err != nil {
+		return nil, err
+	}
+	if bs != nil {
+		rules.Buildsystem, rules.With = bs.Debhelper, bs.With
+		switch bs.Name {
+		case "go":
+			// The build cache must be within the source tree, because
+			// there may be no writable home directory.
+			rules.Exports = append(rules.Exports,
+				"GOCACHE := $(CURDIR)/debian/.gocache")
+			command, version := goCommand()
+			build := "go build -trimpath"
+			if version {
+				// The version is set in the same way as by sanepack's
+				// own Makefile, from the version of the package.
+				rules.Includes = append(rules.Includes,
+					"/usr/share/dpkg/pkg-info.mk")
+				build += ` -ldflags "-X main.Version=$(DEB_VERSION_UPSTREAM)"`
+			}
+			clean := "rm -rf debian/.gocache"
+			if command {
+				build += " -o " + p.ProjectName + " ."
+				clean += " " + p.ProjectName
+			} else {
+				build += " -o ./ ./..."
+			}
+			rules.override("dh_auto_build", nil, build)
+			rules.override("dh_auto_clean", nil, clean)
+		case "cargo":
+			rules.Exports = append(rules.Exports,
+				"CARGO_HOME := $(CURDIR)/debian/.cargo")
+			rules.override("dh_auto_build", nil, "cargo build --release")
+			rules.override("dh_auto_clean", nil, "cargo clean",
+				"rm -rf debian/.cargo")
+		}
+	}
+
+	if p.Build != nil {
+		if len(p.Build.Build) > 0 {
+			rules.override("dh_auto_build", nil, p.Build.Build...)
+		}
+		if len(p.Build.Install) > 0 {
+			rules.override("dh_auto_install",
+				[]string{"DESTDIR := $(CURDIR)/debian/tmp"}, p.Build.Install...)
+		}
 	}
 	return
 }
 
-// manpages creates a "debian/<name>.manpages" file containing every
-// path in the manpages slice, one per line.
-func (d DebianFrameworker) manpages(name string, manpages []string) (err error) {
-	// Begin by trying to open the debian/<name>.manpages file.
-	f, err := os.Create("debian/" + name + ".manpages")
+// override adds a target which overrides the given debhelper command,
+// such as "dh_auto_build," with the given commands, replacing any
+// previous override of the same command. The exports are set for the
+// target only.
+func (r *debianRulesFile) override(command string, exports []string, commands ...string) {
+	o := &debianOverride{command, exports, commands}
+	for i, existing := range r.Overrides {
+		if existing.Target == command {
+			r.Overrides[i] = o
+			return
+		}
+	}
+	r.Overrides = append(r.Overrides, o)
+}
+
+// execute creates the named file with the given mode and executes the
+// named template into it.
+func (d DebianFrameworker) execute(filename string, mode os.FileMode, name string, data interface{}) (err error) {
+	f, err := d.g.CreateMode(filename, mode)
 	if err != nil {
 		return
 	}
 	defer f.Close()
 
-	// If the file is opened properly, use fmt.Fprintln() to write the
-	// manpages in, one per line.
-	for _, page := range manpages {
-		fmt.Fprintln(f, page)
+	return d.t.ExecuteTemplate(f, name, data)
+}
+
+// newDebianCopyrightFile creates a debianCopyrightFile from the
+// Copyright of the Package, which is required.
+func newDebianCopyrightFile(ctx templateContext) (copyright *debianCopyrightFile, err error) {
+	p := ctx.Package
+	if p.Copyright == nil {
+		return nil, errors.New("debian: Copyright is not given; " +
+			"run 'sanepack lint' for details")
+	}
+	copyright = &debianCopyrightFile{templateContext: ctx, Copyright: *p.Copyright}
+	copyright.Homepage = p.Homepage
+
+	// If no files are given, all are owned by the ProjectOwners
+	// under the license of the project.
+	files := p.Copyright.Files
+	if len(files) == 0 {
+		files = []*fileCopyright{{Glob: "*", License: p.Copyright.License}}
+	}
+	// Licenses are given as SPDX expressions, and are translated to
+	// the Debian short names. Each single license in an expression
+	// needs a paragraph of its own.
+	var licenses []*licenseExpr
+	add := func(license string) (debian string, err error) {
+		expr, err := parseLicense(license)
+		if err != nil {
+			return "", fmt.Errorf("debian: invalid license %q: %s",
+				license, err)
+		}
+		for _, single := range expr.Licenses() {
+			if !containsLicense(licenses, single) {
+				licenses = append(licenses, single)
+			}
+		}
+		return expr.Debian(), nil
 	}
 
-	f.Close()
+	for _, f := range files {
+		stanza := &debianFilesStanza{Files: f.Glob, Comment: f.Comment}
+		stanza.License, err = add(f.License)
+		if err != nil {
+			return nil, err
+		}
+		var owners []Person
+		if len(f.Owner.Name) > 0 {
+			owners = append(owners, f.Owner)
+		}
+		owners = append(owners, f.Owners...)
+		if len(owners) == 0 {
+			owners = p.ProjectOwners
+		}
+		for _, owner := range owners {
+			years := owner.Years
+			if len(years) == 0 {
+				years = f.Years
+			}
+			if len(years) == 0 && f.Year > 0 {
+				years = strconv.Itoa(f.Year)
+			}
+			stanza.Copyright = append(stanza.Copyright,
+				strings.TrimSpace(years+" "+owner.String()))
+		}
+		copyright.Stanzas = append(copyright.Stanzas, stanza)
+	}
+
+	// Every license is given in full in a paragraph of its own, so
+	// that each is written only once. The license file of the
+	// project is only used if the project has a single license.
+	var project string
+	if len(p.Copyright.License) > 0 {
+		_, err = add(p.Copyright.License)
+		if err != nil {
+			return nil, err
+		}
+		expr, _ := parseLicense(p.Copyright.License)
+		if len(expr.Op) == 0 {
+			project = expr.String()
+		}
+	}
+	for _, license := range licenses {
+		text, err := licenseText(license, license.String() == project,
+			p.Copyright)
+		if err != nil {
+			return nil, err
+		}
+		copyright.Licenses = append(copyright.Licenses,
+			&debianLicense{debianLicenseName(license), text})
+	}
 	return
 }
 
-// rules copies the template file to "debian/rules" and does *not*
-// interpret the template in any way.
-func (d DebianFrameworker) rules() (err error) {
-	// Begin by trying to open the initscript file.
-	fi, err := os.Open(path.Join(*fTemp, "debian/rules"))
+// containsLicense returns true if the single license is in the list.
+func containsLicense(licenses []*licenseExpr, license *licenseExpr) bool {
+	for _, l := range licenses {
+		if l.String() == license.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// service creates a "debian/<name>.<unit>" file, such as
+// "debian/foo.foo-worker.service," containing the given unit.
+func (d DebianFrameworker) service(ctx templateContext, name string, s *Service) (err error) {
+	contents, err := s.Contents(d.t, ctx)
 	if err != nil {
 		return
 	}
-	defer fi.Close()
-	// If that succeeds, open the debian/rules file in the same manner
-	// that os.Create() would, but with the executable permission set.
-	fo, err := os.OpenFile("debian/rules",
-		os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0777)
+	unit, ext := debianUnitName(name, s)
+
+	f, err := d.g.Create("debian/" + name + "." + unit + ext)
 	if err != nil {
 		return
 	}
-	defer fo.Close()
+	defer f.Close()
 
-	// Now, copy the contents directly using io.Copy().
-	_, err = io.Copy(fo, fi) // (destination, source)
+	_, err = io.WriteString(f, contents)
 	return
 }
 
+// debianUnitName splits the name of a unit into the name by which
+// dh_installsystemd knows it and the unit type extension, such as
+// "foo" and ".service."
+func debianUnitName(name string, s *Service) (unit, ext string) {
+	unit = s.Unit(name)
+	ext = path.Ext(unit)
+	return strings.TrimSuffix(unit, ext), ext
+}
+
+type debianRulesFile struct {
+	templateContext
+	Buildsystem, With string
+	Includes, Exports []string
+	Overrides         []*debianOverride
+	Systemd           []string
+}
+
+// A debianOverride is an override target in debian/rules, such as
+// "override_dh_auto_build."
+type debianOverride struct {
+	Target            string
+	Exports, Commands []string
+}
+
+type debianCopyrightFile struct {
+	templateContext
+	Copyright
+	Stanzas  []*debianFilesStanza
+	Licenses []*debianLicense
+}
+
+// A debianFilesStanza is a "Files" paragraph of debian/copyright, with
+// one line for each copyright holder.
+type debianFilesStanza struct {
+	Files, License, Comment string
+	Copyright               []string
+}
+
+// A debianLicense is a standalone "License" paragraph of
+// debian/copyright, with the full text of the license.
+type debianLicense struct {
+	Name, Text string
+}
+
+// debianBinaryFile is the data given to the templates of the files
+// which belong to a single binary package, such as
+// "debian/<name>.install."
+type debianBinaryFile struct {
+	templateContext
+	Binary *BinaryPackage
+}
+
+// debianScriptFile is the data given to the template of a maintainer
+// script, such as "debian/<name>.postinst."
+type debianScriptFile struct {
+	templateContext
+	Binary *BinaryPackage
+
+	// Script is the name of the maintainer script, such as "postinst,"
+	// and Inline is its inline snippet, if any.
+	Script, Inline string
+}
+
 type debianChangelogFile struct {
-	Name, Version, Date string
-	Maintainer          Person
-	Changes             []string
+	templateContext
+	Name    string
+	Entries []*debianChangelogEntry
+}
+
+type debianChangelogEntry struct {
+	Version, Date string
+	Maintainer    Person
+	Sections      []*changelogSection
 }
 
 type debianControlFile struct {
-	Name, Section, Priority, Architecture, StandardsVersion string
-	Homepage, Description, LongDescription                  string
-	Maintainer                                              Person
-	BuildDepends, Depends, Recommends                       string
-	Suggests, Conflicts, Provides, Replaces                 string
-	Include                                                 map[string]bool
+	templateContext
+	Name, Section, Priority, StandardsVersion string
+	Homepage, BuildDepends, Uploaders         string
+	Maintainer                                Person
+	Binaries                                  []*debianBinaryControl
+	Include                                   map[string]bool
+}
+
+type debianBinaryControl struct {
+	Source                                  *debianControlFile
+	Name, Architecture, Version             string
+	Description, LongDescription            string
+	InstalledSize                           int64
+	Depends, Recommends                     string
+	Suggests, Conflicts, Provides, Replaces string
+	Include                                 map[string]bool
 }
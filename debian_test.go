@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDebianDescription(t *testing.T) {
+	tests := []struct {
+		long, want string
+	}{
+		{"", ""},
+		{" \n\n", ""},
+		{"One line.", " One line.\n"},
+		{"One.\n\nTwo.", " One.\n .\n Two.\n"},
+	}
+	for _, test := range tests {
+		if s := debianDescription(test.long); s != test.want {
+			t.Errorf("debianDescription(%q) = %q, want %q", test.long, s, test.want)
+		}
+	}
+}
+
+func TestDebianVersion(t *testing.T) {
+	tests := []struct {
+		p    Package
+		want string
+	}{
+		{Package{Version: "1.2.0"}, "1.2.0"},
+		{Package{Version: "1.2.0", Revision: "1"}, "1.2.0-1"},
+		{Package{Version: "1.2.0", Epoch: 2, Revision: "3"}, "2:1.2.0-3"},
+		{Package{Version: "1.2.0", Epoch: 1}, "1:1.2.0"},
+	}
+	for _, test := range tests {
+		version, err := debianVersion(&test.p)
+		if err != nil {
+			t.Errorf("debianVersion(%+v): %s", test.p, err)
+			continue
+		}
+		if version != test.want {
+			t.Errorf("debianVersion(%+v) = %q, want %q", test.p, version,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// A requirement is something which the project needs in order to be
+// built or run, such as the Go toolchain, as inferred from the files
+// of the project.
+type requirement struct {
+	// Name is the name by which the requirement is looked up in the
+	// requirement tables, such as "go," "cgo," or the name of a build
+	// system.
+	Name string
+
+	// Version is the minimum version required, if it is known, such
+	// as "1.21" from the go directive of go.mod.
+	Version string
+}
+
+// requirementPackages are the packages which satisfy a requirement on
+// one type of distribution, given as Relations in the same form as
+// BuildDepends and Depends. Their versions may contain "$VERSION,"
+// which is replaced by the version of the requirement. If its version
+// is not known, the version of the relation is dropped.
+type requirementPackages struct {
+	BuildDepends []Relation `json:",omitempty"`
+	Depends      []Relation `json:",omitempty"`
+}
+
+// requirementTables map the requirements inferred from a project to
+// the packages which satisfy them, for each package type. Packages
+// which every build environment has, such as those which Debian marks
+// build-essential or which Arch includes in base-devel, are left out.
+var requirementTables = map[string]map[string]*requirementPackages{
+	"deb": {
+		// golang-go has the epoch 2, and its versions, such as
+		// "2:1.21~2," sort before "2:1.21" because of the tilde.
+		"go":        {BuildDepends: mustParseRelations("golang-go (>= 2:$VERSION~)")},
+		"cgo":       {Depends: mustParseRelations("libc6")},
+		"cmake":     {BuildDepends: mustParseRelations("cmake")},
+		"meson":     {BuildDepends: mustParseRelations("meson", "ninja-build")},
+		"autotools": {BuildDepends: mustParseRelations("autoconf", "automake")},
+		"cargo":     {BuildDepends: mustParseRelations("cargo", "rustc")},
+		"python": {
+			BuildDepends: mustParseRelations("dh-python", "python3-all", "python3-setuptools"),
+			Depends:      mustParseRelations("python3"),
+		},
+		"make": {},
+	},
+	"rpm": {
+		"go":        {BuildDepends: mustParseRelations("golang (>= $VERSION)")},
+		"cgo":       {BuildDepends: mustParseRelations("gcc"), Depends: mustParseRelations("glibc")},
+		"cmake":     {BuildDepends: mustParseRelations("cmake", "gcc-c++")},
+		"meson":     {BuildDepends: mustParseRelations("meson", "gcc")},
+		"autotools": {BuildDepends: mustParseRelations("autoconf", "automake", "gcc", "make")},
+		"cargo":     {BuildDepends: mustParseRelations("cargo", "rust")},
+		"python": {
+			BuildDepends: mustParseRelations("python3-devel", "python3-setuptools"),
+			Depends:      mustParseRelations("python3"),
+		},
+		"make": {BuildDepends: mustParseRelations("make")},
+	},
+	"arch": {
+		// As in Debian, go has the epoch 2.
+		"go":        {BuildDepends: mustParseRelations("go (>= 2:$VERSION)")},
+		"cgo":       {Depends: mustParseRelations("glibc")},
+		"cmake":     {BuildDepends: mustParseRelations("cmake")},
+		"meson":     {BuildDepends: mustParseRelations("meson")},
+		"autotools": {},
+		"cargo":     {BuildDepends: mustParseRelations("rust")},
+		"python": {
+			BuildDepends: mustParseRelations("python-build", "python-installer", "python-setuptools"),
+			Depends:      mustParseRelations("python"),
+		},
+		"make": {},
+	},
+}
+
+// goDirective matches the go directive of a go.mod file, and captures
+// the major and minor version of Go which the module requires.
+var goDirective = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`)
+
+// goCgoImport matches the import of the "C" pseudo-package, either on
+// its own or within an import block, which marks a file as using cgo.
+var goCgoImport = regexp.MustCompile(`(?m)^(?:import)?\s*"C"\s*$`)
+
+// inferRequirements inspects the files of the project in the current
+// directory and returns what it requires. Every build system whose
+// files are present is required, since projects often use several
+// together, such as a Makefile which runs "go build," as is the build
+// system given in the BuildOptions of the Package.
+func inferRequirements(p *Package) (reqs []requirement) {
+	var names []string
+	if p.Build != nil && len(p.Build.System) > 0 {
+		names = append(names, p.Build.System)
+	}
+	for _, bs := range buildSystems {
+		for _, file := range bs.Files {
+			if _, err := os.Stat(file); err == nil && !contains(names, bs.Name) {
+				names = append(names, bs.Name)
+			}
+		}
+	}
+	if sources, _ := filepath.Glob("*.go"); len(sources) > 0 && !contains(names, "go") {
+		names = append(names, "go")
+	}
+
+	for _, name := range names {
+		req := requirement{Name: name}
+		if name == "go" {
+			if mod, err := os.ReadFile("go.mod"); err == nil {
+				if m := goDirective.FindSubmatch(mod); m != nil {
+					req.Version = string(m[1])
+				}
+			}
+		}
+		l.Debugf("Inferred requirement %q %s\n", req.Name, req.Version)
+		reqs = append(reqs, req)
+	}
+	if contains(names, "go") && goUsesCgo() {
+		l.Debug("Inferred requirement \"cgo\"\n")
+		reqs = append(reqs, requirement{Name: "cgo"})
+	}
+	return
+}
+
+// goUsesCgo reports whether any Go source file of the project, outside
+// of vendored and test data directories, imports "C."
+func goUsesCgo() (cgo bool) {
+	filepath.WalkDir(".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return filepath.SkipDir
+		}
+		if cgo {
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			base := d.Name()
+			if name != "." && (strings.HasPrefix(base, ".") ||
+				base == "vendor" || base == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		contents, err := os.ReadFile(name)
+		if err == nil && goCgoImport.Match(contents) {
+			cgo = true
+		}
+		return nil
+	})
+	return
+}
+
+// inferDepends infers the requirements of the project and maps them to
+// the build and runtime dependencies of the given package type, such
+// as "deb." The Requirements given in the BuildOptions of the Package
+// are used in place of the built in entries of the same names.
+func inferDepends(p *Package, packageType string) (buildDepends, depends []Relation) {
+	for _, req := range inferRequirements(p) {
+		pkgs := requirementTables[packageType][req.Name]
+		if p.Build != nil {
+			if override, ok := p.Build.Requirements[packageType][req.Name]; ok {
+				pkgs = override
+			}
+		}
+		if pkgs == nil {
+			l.Debugf("No %s packages are known to satisfy %q\n",
+				packageType, req.Name)
+			continue
+		}
+		buildDepends = mergeRelations(buildDepends,
+			req.relations(pkgs.BuildDepends))
+		depends = mergeRelations(depends, req.relations(pkgs.Depends))
+	}
+	return
+}
+
+// relations fills the version of the requirement into the given
+// relations and their alternatives.
+func (req requirement) relations(relations []Relation) (filled []Relation) {
+	for _, r := range relations {
+		if strings.Contains(r.Version, "$VERSION") {
+			if len(req.Version) == 0 {
+				r.Op, r.Version = "", ""
+			} else {
+				r.Version = strings.Replace(r.Version, "$VERSION", req.Version, -1)
+			}
+		}
+		r.Alternatives = req.relations(r.Alternatives)
+		filled = append(filled, r)
+	}
+	return
+}
+
+// mergeRelations returns the relations with those added which name
+// packages not already named by any of them. A relation which names
+// only a package, without a version, is replaced by an added relation
+// on the same package with a version. The given slice is not modified.
+func mergeRelations(relations, added []Relation) (merged []Relation) {
+	merged = append(merged, relations...)
+	names := make([]string, 0, len(merged))
+	for _, relation := range merged {
+		for _, choice := range relation.Choices() {
+			names = append(names, choice.Name)
+		}
+	}
+	for _, relation := range added {
+		if !contains(names, relation.Name) {
+			merged = append(merged, relation)
+			names = append(names, relation.Name)
+			continue
+		}
+		for i, existing := range merged {
+			if existing.String() == relation.Name && len(relation.Op) > 0 {
+				merged[i] = relation
+			}
+		}
+	}
+	return
+}
+
+// addInferredDepends adds the dependencies inferred for the given
+// package type to the BuildDepends of the Package, and to the Depends
+// of every binary package, where they are not already given.
+func (p *Package) addInferredDepends(packageType string) {
+	buildDepends, depends := inferDepends(p, packageType)
+	p.BuildDepends = mergeRelations(p.BuildDepends, buildDepends)
+	if len(p.Packages) == 0 {
+		p.Depends = mergeRelations(p.Depends, depends)
+	}
+	for _, b := range p.Packages {
+		b.Depends = mergeRelations(b.Depends, depends)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// packageFormat determines the format of a sanepack file from its
+// extension. Files with unknown extensions are assumed to be JSON.
+func packageFormat(filename string) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// decodePackage reads a Package from r, in the format indicated by
+// filename. Errors are prefixed with the filename, line, and column
+// at which they occurred, where possible.
+func decodePackage(filename string, r io.Reader) (p *Package, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+
+	p = new(Package)
+	switch packageFormat(filename) {
+	case "yaml":
+		err = decodeYAML(filename, data, p)
+	case "toml":
+		err = decodeTOML(filename, data, p)
+	default:
+		err = decodeJSON(filename, data, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// encodePackage writes p to w, in the format indicated by filename.
+// YAML and TOML are encoded by way of JSON, so that the keys are the
+// same as those in JSON sanepack files and empty fields are left out.
+func encodePackage(filename string, w io.Writer, p *Package) (err error) {
+	var buf bytes.Buffer
+	e := json.NewEncoder(&buf)
+	e.SetEscapeHTML(false)
+
+	switch packageFormat(filename) {
+	case "yaml":
+		err = e.Encode(p)
+		if err != nil {
+			return
+		}
+		node, err := jsonToYAML(json.NewDecoder(&buf))
+		if err != nil {
+			return err
+		}
+		e := yaml.NewEncoder(w)
+		e.SetIndent(2)
+		err = e.Encode(node)
+		if err != nil {
+			return err
+		}
+		return e.Close()
+	case "toml":
+		err = e.Encode(p)
+		if err != nil {
+			return
+		}
+		// The TOML encoder sorts the keys of maps, so unlike YAML
+		// the fields are not in the order in which they are
+		// declared.
+		var v interface{}
+		dec := json.NewDecoder(&buf)
+		dec.UseNumber()
+		err = dec.Decode(&v)
+		if err != nil {
+			return
+		}
+		return toml.NewEncoder(w).Encode(jsonToTOML(v))
+	}
+
+	e.SetIndent("", "\t")
+	err = e.Encode(p)
+	if err != nil {
+		return
+	}
+	_, err = buf.WriteTo(w)
+	return
+}
+
+// jsonToTOML converts a decoded JSON value into one that the TOML
+// encoder accepts: numbers become integers where possible, and nulls,
+// which TOML cannot represent, are dropped.
+func jsonToTOML(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if value == nil {
+				delete(v, key)
+				continue
+			}
+			v[key] = jsonToTOML(value)
+		}
+	case []interface{}:
+		values := v[:0]
+		for _, value := range v {
+			if value != nil {
+				values = append(values, jsonToTOML(value))
+			}
+		}
+		return values
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return v
+}
+
+// decodeJSON decodes data into p, and converts the byte offsets of
+// any errors to lines and columns.
+func decodeJSON(filename string, data []byte, p *Package) error {
+	err := json.Unmarshal(data, p)
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *json.SyntaxError:
+		line, col := position(data, e.Offset)
+		return positionError(filename, line, col, e)
+	case *json.UnmarshalTypeError:
+		line, col := position(data, e.Offset)
+		return positionError(filename, line, col, e)
+	}
+	return fmt.Errorf("%s: %s", filename, err)
+}
+
+// tomlLine matches the line number with which the TOML decoder
+// prefixes its errors.
+var tomlLine = regexp.MustCompile(`^toml: line (\d+)(?:: | )`)
+
+// decodeTOML decodes data into p, and reports the line and column of
+// any errors. Syntax errors carry the offset at which they occurred,
+// but errors in the types of values carry only the line of their key,
+// so the column given for those is that of the key.
+func decodeTOML(filename string, data []byte, p *Package) error {
+	_, err := toml.Decode(string(data), p)
+	if err == nil {
+		return nil
+	}
+
+	var line, col int
+	message := err.Error()
+	var e toml.ParseError
+	if errors.As(err, &e) {
+		line, col = position(data, int64(e.Position.Start))
+		if len(e.Message) > 0 {
+			message = "toml: " + e.Message
+		}
+	} else if m := tomlLine.FindStringSubmatch(message); m != nil {
+		line, _ = strconv.Atoi(m[1])
+		lines := bytes.SplitAfter(data, []byte("\n"))
+		if line > len(lines) {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		text := lines[line-1]
+		col = len(text) - len(bytes.TrimLeft(text, " \t")) + 1
+	} else {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	message = tomlLine.ReplaceAllString(message, "toml: ")
+	return positionError(filename, line, col, errors.New(message))
+}
+
+// decodeYAML decodes data into p. The YAML is first parsed into a
+// node tree, which is then converted to JSON and decoded as a JSON
+// sanepack file would be, so that the keys are the same in both
+// formats. The nodes are used to find the line and column of errors.
+func decodeYAML(filename string, data []byte, p *Package) error {
+	var root yaml.Node
+	err := yaml.Unmarshal(data, &root)
+	if err != nil {
+		// Syntax errors already carry the line on which they
+		// occurred.
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+
+	c := new(yamlConverter)
+	err = c.convert(&root)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	err = json.Unmarshal(c.Bytes(), p)
+	if e, ok := err.(*json.UnmarshalTypeError); ok {
+		if node := c.find(e.Offset); node != nil {
+			value := node.Value
+			if node.Kind != yaml.ScalarNode {
+				value = node.ShortTag()
+			}
+			return positionError(filename, node.Line, node.Column,
+				fmt.Errorf("cannot use %q as %s in field %s",
+					value, e.Type, e.Field))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	return nil
+}
+
+// yamlConverter converts a YAML node tree into equivalent JSON, and
+// records the span of JSON produced by each node so that errors in
+// the JSON can be traced back to the YAML.
+type yamlConverter struct {
+	bytes.Buffer
+	spans []yamlSpan
+}
+
+type yamlSpan struct {
+	start, end int64
+	node       *yaml.Node
+}
+
+// convert writes the JSON equivalent of node.
+func (c *yamlConverter) convert(node *yaml.Node) (err error) {
+	start := int64(c.Len())
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			c.WriteString("null")
+			return
+		}
+		return c.convert(node.Content[0])
+	case yaml.AliasNode:
+		return c.convert(node.Alias)
+	case yaml.MappingNode:
+		c.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				c.WriteByte(',')
+			}
+			key, err := json.Marshal(node.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			c.Write(key)
+			c.WriteByte(':')
+			err = c.convert(node.Content[i+1])
+			if err != nil {
+				return err
+			}
+		}
+		c.WriteByte('}')
+	case yaml.SequenceNode:
+		c.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				c.WriteByte(',')
+			}
+			err = c.convert(item)
+			if err != nil {
+				return
+			}
+		}
+		c.WriteByte(']')
+	default:
+		// Scalars are decoded according to their tags, so that
+		// numbers, booleans, and nulls are preserved.
+		var v interface{}
+		err = node.Decode(&v)
+		if err != nil {
+			return
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		c.Write(b)
+	}
+	c.spans = append(c.spans, yamlSpan{start, int64(c.Len()), node})
+	return
+}
+
+// find returns the innermost node whose JSON contains the given
+// offset, or nil if there is none.
+func (c *yamlConverter) find(offset int64) (node *yaml.Node) {
+	var size int64 = -1
+	for _, span := range c.spans {
+		if span.start < offset && offset <= span.end &&
+			(size < 0 || span.end-span.start < size) {
+			node, size = span.node, span.end-span.start
+		}
+	}
+	return
+}
+
+// jsonToYAML converts the next JSON value from dec into a YAML node
+// tree, preserving the order of object keys.
+func jsonToYAML(dec *json.Decoder) (node *yaml.Node, err error) {
+	dec.UseNumber()
+	t, err := dec.Token()
+	if err != nil {
+		return
+	}
+	switch v := t.(type) {
+	case json.Delim:
+		if v == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode}
+		} else {
+			node = &yaml.Node{Kind: yaml.SequenceNode}
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{
+					Kind:  yaml.ScalarNode,
+					Value: key.(string),
+				})
+			}
+			child, err := jsonToYAML(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		// Consume the closing delimiter.
+		_, err = dec.Token()
+		return
+	case string:
+		node = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+		if strings.Contains(v, "\n") {
+			node.Style = yaml.LiteralStyle
+		}
+	case json.Number:
+		node = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: v.String()}
+		if strings.ContainsAny(v.String(), ".eE") {
+			node.Tag = "!!float"
+		}
+	case bool:
+		node = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool",
+			Value: fmt.Sprint(v)}
+	default:
+		node = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null",
+			Value: "null"}
+	}
+	return
+}
+
+// position converts a byte offset in data to a line and column, both
+// starting at 1.
+func position(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	col = len(before) - bytes.LastIndex(before, []byte("\n"))
+	return
+}
+
+// positionError prefixes err with the filename, line, and column.
+func positionError(filename string, line, col int, err error) error {
+	return fmt.Errorf("%s:%d:%d: %s", filename, line, col, err)
+}
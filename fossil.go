@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// fossilVCS finds the user, releases, and changes of a Fossil
+// checkout. Fossil has no equivalent of git describe, so releases are
+// found by walking the ancestors of the checkout.
+type fossilVCS struct{}
+
+var (
+	// fossilHash matches the "hash:" line of "fossil info," which is
+	// called "uuid:" by older versions, such as
+	// "hash: 1a2b3c... 2013-06-04 12:00:00 UTC."
+	fossilHash = regexp.MustCompile(`(?m)^(?:hash|uuid): +([0-9a-f]+) +(\S+ \S+)`)
+
+	// fossilUser matches the user at the end of the "comment:" line of
+	// "fossil info."
+	fossilUser = regexp.MustCompile(`(?m)^comment:.*\(user: ([^)]+)\)\s*$`)
+
+	// fossilEntry matches a single entry of "fossil timeline," which
+	// begins with the hash of the check-in.
+	fossilEntry = regexp.MustCompile(`^([0-9a-f]{40,64}) (.*)$`)
+)
+
+func (fossilVCS) Name() string {
+	return "fossil"
+}
+
+// User returns the default user of the repository. Fossil users have
+// no email address.
+func (fossilVCS) User() (user Person, err error) {
+	name, err := exec.Command("fossil", "user", "default").Output()
+	if err != nil {
+		return
+	}
+	return Person{Name: strings.TrimSpace(string(name))}, nil
+}
+
+// Releases returns the releases marked by every "v*" tag, each
+// authored by the user who made the tagged check-in.
+func (f fossilVCS) Releases() (releases []*vcsRelease, err error) {
+	tags, err := exec.Command("fossil", "tag", "list").Output()
+	if err != nil {
+		return
+	}
+	for _, tag := range strings.Fields(string(tags)) {
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		release := newVCSRelease(tag)
+		_, release.Date, release.Author, err = f.info(tag)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+	return
+}
+
+// Describe walks the ancestors of the checkout until one is tagged as
+// a release.
+func (f fossilVCS) Describe() (d *vcsDescription, err error) {
+	d = new(vcsDescription)
+	var hash string
+	hash, d.Date, _, err = f.info("current")
+	if err != nil {
+		return nil, err
+	}
+	d.ID = hash
+	if len(d.ID) > 10 {
+		d.ID = d.ID[:10]
+	}
+
+	tagged := make(map[string]string)
+	releases, err := f.Releases()
+	if err != nil {
+		return nil, err
+	}
+	for _, release := range releases {
+		hash, _, _, err := f.info(release.Tag)
+		if err != nil {
+			return nil, err
+		}
+		tagged[hash] = release.Tag
+	}
+
+	ancestors, err := f.ancestors("current")
+	if err != nil {
+		return nil, err
+	}
+	d.Distance = len(ancestors)
+	for i, ancestor := range ancestors {
+		if tag, ok := tagged[ancestor.hash]; ok {
+			d.Tag, d.Distance = tag, i
+			break
+		}
+	}
+
+	changes, err := exec.Command("fossil", "changes").Output()
+	if err != nil {
+		return nil, err
+	}
+	d.Dirty = hasOutput(changes)
+	return
+}
+
+// Log returns the ancestors of until which are not ancestors of since.
+// Fossil's timeline does not mark merges, so they are always included.
+func (f fossilVCS) Log(since, until string, merges bool) (commits []vcsCommit, err error) {
+	if len(until) == 0 {
+		until = "current"
+	}
+	ancestors, err := f.ancestors(until)
+	if err != nil {
+		return
+	}
+	released := make(map[string]bool)
+	if len(since) > 0 {
+		previous, err := f.ancestors(since)
+		if err != nil {
+			return nil, err
+		}
+		for _, ancestor := range previous {
+			released[ancestor.hash] = true
+		}
+	}
+	for _, ancestor := range ancestors {
+		if !released[ancestor.hash] {
+			commits = append(commits, vcsCommit{Subject: ancestor.comment})
+		}
+	}
+	return
+}
+
+// A fossilCheckin is a single entry in the timeline.
+type fossilCheckin struct {
+	hash, comment string
+}
+
+// ancestors returns the given check-in and each of its ancestors,
+// newest first.
+func (fossilVCS) ancestors(checkin string) (ancestors []fossilCheckin, err error) {
+	timeline, err := exec.Command("fossil", "timeline", "ancestors", checkin,
+		"-t", "ci", "-n", "0", "-W", "0", "-F", "%H %c").Output()
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(timeline), "\n") {
+		if m := fossilEntry.FindStringSubmatch(line); m != nil {
+			ancestors = append(ancestors, fossilCheckin{m[1], m[2]})
+		}
+	}
+	return
+}
+
+// info returns the hash, date, and user of the given check-in.
+func (fossilVCS) info(checkin string) (hash string, date time.Time, user Person, err error) {
+	info, err := exec.Command("fossil", "info", checkin).Output()
+	if err != nil {
+		return
+	}
+	m := fossilHash.FindStringSubmatch(string(info))
+	if m == nil {
+		err = errors.New("fossil: unexpected info output: " + string(info))
+		return
+	}
+	date, err = time.Parse("2006-01-02 15:04:05", m[2])
+	if err != nil {
+		return
+	}
+	if u := fossilUser.FindStringSubmatch(string(info)); u != nil {
+		user.Name = u[1]
+	}
+	return m[1], date, user, nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+)
+
+// generatorDir is the directory in which the manifest of generated
+// files, and a copy of each, is kept between runs. It should be
+// committed along with the files themselves, so that edits can be
+// merged by anyone who regenerates them.
+const generatorDir = ".sanepack"
+
+// A generator collects the files created by a Frameworker and writes
+// them out all at once, so that a framework can be regenerated after
+// the sanepack file changes. Files which the user has not touched
+// since they were last generated are overwritten, and files which the
+// user has edited are merged with the new contents.
+type generator struct {
+	name  string
+	files []*generatedFile
+
+	// mergeTool is the path of git, which is used to merge edits. If
+	// it is empty, edited files are not merged.
+	mergeTool string
+}
+
+// A generatedFile is a file which will be written by the generator.
+type generatedFile struct {
+	bytes.Buffer
+	name string
+	mode os.FileMode
+}
+
+// Close does nothing, because generated files are written when the
+// generator is committed.
+func (f *generatedFile) Close() error {
+	return nil
+}
+
+// A generatorManifest records the checksum and mode of every file
+// generated on the last run, indexed by filename.
+type generatorManifest struct {
+	Files map[string]*generatorEntry
+}
+
+type generatorEntry struct {
+	Checksum string
+	Mode     os.FileMode
+}
+
+// newGenerator creates a generator for the named framework type, such
+// as "debian." Each framework type has its own manifest.
+func newGenerator(name string) *generator {
+	return &generator{name: name}
+}
+
+// Create returns a new file of the given name, which is written when
+// the generator is committed.
+func (g *generator) Create(name string) (*generatedFile, error) {
+	return g.CreateMode(name, 0666)
+}
+
+// CreateMode is the same as Create, but the file is given the
+// executable permissions of mode.
+func (g *generator) CreateMode(name string, mode os.FileMode) (f *generatedFile, err error) {
+	for _, file := range g.files {
+		if file.name == name {
+			return nil, errors.New(g.name + ": " + name + " was generated twice")
+		}
+	}
+	f = &generatedFile{name: name, mode: mode}
+	g.files = append(g.files, f)
+	return
+}
+
+// Commit writes every generated file, merging in any edits the user
+// has made since they were last generated, and updates the manifest.
+// Files which could not be merged cleanly are left for the user to
+// resolve, and are listed in the returned error. Their entries in the
+// manifest, and their bases, are left as they were, so that the same
+// merge is tried again on the next run.
+func (g *generator) Commit() (err error) {
+	last, err := g.manifest()
+	if err != nil {
+		return
+	}
+	// The merge tool is looked for before anything is written, so
+	// that a missing tool cannot leave the files and the manifest out
+	// of step.
+	g.mergeTool, err = exec.LookPath("git")
+	if err != nil {
+		l.Debugf("Not merging edits, because git was not found: %s\n", err)
+		err = nil
+	}
+	var conflicts []string
+	next := &generatorManifest{
+		Files: make(map[string]*generatorEntry, len(g.files)),
+	}
+
+	for _, f := range g.files {
+		// Any contents left alongside the file by the last run are
+		// out of date, and are written again below if the file
+		// still cannot be merged.
+		err = removeFile(f.name + ".sanepack-new")
+		if err != nil {
+			return
+		}
+
+		entry := last.Files[f.name]
+		written, err := g.write(f, entry)
+		if err != nil {
+			return err
+		}
+		if !written {
+			// The generated contents are not yet in the file, so
+			// the last generated contents remain the base of the
+			// next merge.
+			conflicts = append(conflicts, f.name)
+			if entry != nil {
+				next.Files[f.name] = entry
+			}
+			continue
+		}
+
+		// The generated contents are kept as the base of the next
+		// merge.
+		generated := f.Bytes()
+		next.Files[f.name] = &generatorEntry{checksum(generated), f.mode}
+		err = writeFile(g.base(f.name), generated, 0666)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Files which were generated last time but not this time are
+	// removed, unless the user has edited them.
+	for name, entry := range last.Files {
+		if next.Files[name] != nil {
+			continue
+		}
+		current, err := ioutil.ReadFile(name)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return err
+		case checksum(current) == entry.Checksum:
+			l.Debugf("Removing %s, which is no longer generated\n", name)
+			err = os.Remove(name)
+		default:
+			l.Infof("Keeping %s, which is no longer generated but "+
+				"has been edited\n", name)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		os.Remove(g.base(name))
+		err = removeFile(name + ".sanepack-new")
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := json.MarshalIndent(next, "", "\t")
+	if err != nil {
+		return
+	}
+	err = writeFile(path.Join(generatorDir, g.name, "manifest.json"), b, 0666)
+	if err == nil && len(conflicts) > 0 {
+		err = fmt.Errorf("%s: %d files have conflicts which must be "+
+			"resolved: %s", g.name, len(conflicts), concat(", ", conflicts...))
+	}
+	return
+}
+
+// write writes a single generated file, given its entry in the last
+// manifest, if any, and reports whether the file now holds the
+// generated contents. If it does not, because the user's edits could
+// not be merged cleanly, the conflict has been left for the user to
+// resolve.
+func (g *generator) write(f *generatedFile, entry *generatorEntry) (written bool, err error) {
+	generated := f.Bytes()
+	current, err := ioutil.ReadFile(f.name)
+	switch {
+	case os.IsNotExist(err):
+		l.Debugf("Writing %s\n", f.name)
+		return true, writeFile(f.name, generated, f.mode)
+	case err != nil:
+		return
+	case bytes.Equal(current, generated):
+		l.Debugf("Leaving %s, which is unchanged\n", f.name)
+		return true, nil
+	case entry != nil && checksum(current) == entry.Checksum:
+		l.Debugf("Overwriting %s, which has not been edited\n", f.name)
+		return true, writeFile(f.name, generated, f.mode)
+	}
+
+	// Otherwise, the file has been edited, or was not generated by
+	// sanepack. Without the contents which were last generated, there
+	// is nothing to merge against, so the new contents are written
+	// alongside the file.
+	base, err := ioutil.ReadFile(g.base(f.name))
+	if entry == nil || err != nil {
+		l.Println("Conflict: " + f.name + " was not generated by " +
+			"sanepack; the generated file is " + f.name + ".sanepack-new")
+		return false, writeFile(f.name+".sanepack-new", generated, f.mode)
+	}
+	if len(g.mergeTool) == 0 {
+		l.Println("Conflict: edits to " + f.name + " cannot be merged " +
+			"without git; the generated file is " + f.name + ".sanepack-new")
+		return false, writeFile(f.name+".sanepack-new", generated, f.mode)
+	}
+
+	l.Infof("Merging edits to %s\n", f.name)
+	merged, conflict, err := merge(g.mergeTool, f.name, current, base, generated)
+	if err != nil {
+		l.Println("Conflict: edits to " + f.name + " could not be " +
+			"merged (" + err.Error() + "); the generated file is " +
+			f.name + ".sanepack-new")
+		return false, writeFile(f.name+".sanepack-new", generated, f.mode)
+	}
+	if conflict {
+		l.Println("Conflict: edits to " + f.name + " could not be " +
+			"merged; resolve the conflict markers by hand")
+	}
+	return !conflict, writeFile(f.name, merged, f.mode)
+}
+
+// manifest reads the manifest from the last run. If there is none,
+// an empty manifest is returned.
+func (g *generator) manifest() (manifest *generatorManifest, err error) {
+	manifest = new(generatorManifest)
+	b, err := ioutil.ReadFile(path.Join(generatorDir, g.name, "manifest.json"))
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, manifest)
+	return
+}
+
+// base returns the name of the copy of the last generated contents of
+// the named file.
+func (g *generator) base(name string) string {
+	return path.Join(generatorDir, g.name, "files", name)
+}
+
+// merge performs a three-way merge of the user's edits to a file and
+// the newly generated contents, using the last generated contents as
+// the base. It uses "git merge-file," run from the given path, and
+// reports whether there were conflicts, in which case they are marked
+// in the merged result.
+func merge(git, name string, current, base, generated []byte) (merged []byte, conflict bool, err error) {
+	dir, err := ioutil.TempDir("", "sanepack")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{"current", "base", "generated"}
+	for i, contents := range [][]byte{current, base, generated} {
+		files[i] = path.Join(dir, files[i])
+		err = ioutil.WriteFile(files[i], contents, 0666)
+		if err != nil {
+			return
+		}
+	}
+
+	merged, err = exec.Command(git, "merge-file", "-p",
+		"-L", name, "-L", name+" (last generated)",
+		"-L", name+" (generated)",
+		files[0], files[1], files[2]).Output()
+
+	// git merge-file exits with the number of conflicts, or a
+	// negative number on error.
+	if e, ok := err.(*exec.ExitError); ok && e.ExitCode() > 0 &&
+		e.ExitCode() < 128 {
+		return merged, true, nil
+	}
+	return
+}
+
+// checksum returns the SHA-256 checksum of the given data.
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// removeFile removes the named file, if it exists.
+func removeFile(name string) (err error) {
+	err = os.Remove(name)
+	if err == nil {
+		l.Debugf("Removed %s\n", name)
+	} else if os.IsNotExist(err) {
+		err = nil
+	}
+	return
+}
+
+// writeFile writes data to the named file, creating it and any
+// missing parent directories. If mode has any executable bits, they
+// are set on the file, even if it already exists.
+func writeFile(name string, data []byte, mode os.FileMode) (err error) {
+	err = os.MkdirAll(path.Dir(name), 0777)
+	if err != nil {
+		return
+	}
+	err = ioutil.WriteFile(name, data, mode)
+	if err != nil || mode&0111 == 0 {
+		return
+	}
+	fi, err := os.Stat(name)
+	if err != nil {
+		return
+	}
+	return os.Chmod(name, fi.Mode()|mode&0111)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"testing"
+)
+
+// inTempDir changes to a new temporary directory for the rest of the
+// test, since the generator works relative to the current directory.
+func inTempDir(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+// needGit skips the test if git, which is used to merge edits, is not
+// installed.
+func needGit(t *testing.T) string {
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+	return git
+}
+
+// generate runs a generator which writes each of the files, and
+// returns the error from Commit.
+func generate(t *testing.T, files map[string]string) error {
+	g := newGenerator("test")
+	for name, contents := range files {
+		f, err := g.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(contents)
+	}
+	return g.Commit()
+}
+
+// readString returns the contents of the named file, or "<missing>"
+// if it does not exist.
+func readString(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) {
+		return "<missing>"
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMerge(t *testing.T) {
+	git := needGit(t)
+	tests := []struct {
+		current, base, generated string
+		want                     string
+		conflict                 bool
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", "a\nb\nc\nd\n", "a\nb\nc\nd\n", false},
+		{"a\nB\nc\n", "a\nb\nc\n", "a\nb\nc\nd\n", "a\nB\nc\nd\n", false},
+		{"a\nB\nc\n", "a\nb\nc\n", "a\nb\nc\n", "a\nB\nc\n", false},
+		{"a\nB\nc\n", "a\nb\nc\n", "a\nB\nc\n", "a\nB\nc\n", false},
+		{
+			"a\nX\nc\n", "a\nb\nc\n", "a\nY\nc\n",
+			"a\n<<<<<<< f\nX\n=======\nY\n>>>>>>> f (generated)\nc\n", true,
+		},
+	}
+	for _, test := range tests {
+		merged, conflict, err := merge(git, "f", []byte(test.current),
+			[]byte(test.base), []byte(test.generated))
+		if err != nil {
+			t.Errorf("merge(%q, %q, %q): %s", test.current, test.base,
+				test.generated, err)
+			continue
+		}
+		if string(merged) != test.want || conflict != test.conflict {
+			t.Errorf("merge(%q, %q, %q) = %q, %t, want %q, %t",
+				test.current, test.base, test.generated,
+				merged, conflict, test.want, test.conflict)
+		}
+	}
+}
+
+func TestGeneratorRegenerate(t *testing.T) {
+	needGit(t)
+	inTempDir(t)
+
+	err := generate(t, map[string]string{"f": "a\nb\nc\n", "old": "x\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits are merged with each new generation, which requires the
+	// base to be updated every time.
+	err = ioutil.WriteFile("f", []byte("a\nB\nc\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct{ generated, want string }{
+		{"a\nb\nc\nd\n", "a\nB\nc\nd\n"},
+		{"a\nb\nc\nd\ne\n", "a\nB\nc\nd\ne\n"},
+	} {
+		err = generate(t, map[string]string{"f": test.generated})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := readString(t, "f"); s != test.want {
+			t.Errorf("f = %q, want %q", s, test.want)
+		}
+		if s := readString(t, "old"); s != "<missing>" {
+			t.Errorf("old = %q, want it removed", s)
+		}
+	}
+}
+
+func TestGeneratorConflict(t *testing.T) {
+	needGit(t)
+	inTempDir(t)
+	g := newGenerator("test")
+	manifest := path.Join(generatorDir, "test", "manifest.json")
+
+	err := generate(t, map[string]string{"f": "a\nb\nc\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastManifest := readString(t, manifest)
+
+	// A conflict leaves the manifest and the base as they were.
+	err = ioutil.WriteFile("f", []byte("a\nX\nc\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = generate(t, map[string]string{"f": "a\nY\nc\n"})
+	if err == nil {
+		t.Error("Commit() succeeded despite a conflict")
+	}
+	if s := readString(t, manifest); s != lastManifest {
+		t.Errorf("manifest = %q, want %q", s, lastManifest)
+	}
+	if s := readString(t, g.base("f")); s != "a\nb\nc\n" {
+		t.Errorf("base = %q, want %q", s, "a\nb\nc\n")
+	}
+
+	// Once the conflict is resolved, the same merge is clean.
+	err = ioutil.WriteFile("f", []byte("a\nY\nc\nd\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = generate(t, map[string]string{"f": "a\nY\nc\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := readString(t, "f"); s != "a\nY\nc\nd\n" {
+		t.Errorf("f = %q, want %q", s, "a\nY\nc\nd\n")
+	}
+	if s := readString(t, g.base("f")); s != "a\nY\nc\n" {
+		t.Errorf("base = %q, want %q", s, "a\nY\nc\n")
+	}
+}
+
+func TestGeneratorWithoutGit(t *testing.T) {
+	git := needGit(t)
+	inTempDir(t)
+
+	err := generate(t, map[string]string{"f": "a\nb\nc\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile("f", []byte("a\nB\nc\n"), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without git, the new contents are left alongside the file.
+	t.Setenv("PATH", "")
+	err = generate(t, map[string]string{"f": "a\nb\nc\nd\n"})
+	if err == nil {
+		t.Error("Commit() succeeded without merging")
+	}
+	if s := readString(t, "f.sanepack-new"); s != "a\nb\nc\nd\n" {
+		t.Errorf("f.sanepack-new = %q, want %q", s, "a\nb\nc\nd\n")
+	}
+
+	// The edits are merged on the next run with git, against the
+	// base from before, and the stale new contents are removed.
+	os.Setenv("PATH", path.Dir(git))
+	err = generate(t, map[string]string{"f": "a\nb\nc\nd\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := readString(t, "f"); s != "a\nB\nc\nd\n" {
+		t.Errorf("f = %q, want %q", s, "a\nB\nc\nd\n")
+	}
+	if s := readString(t, "f.sanepack-new"); s != "<missing>" {
+		t.Errorf("f.sanepack-new = %q, want it removed", s)
+	}
+}
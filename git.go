@@ -0,0 +1,180 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitVCS finds the user, releases, and changes of a git repository.
+type gitVCS struct{}
+
+func (gitVCS) Name() string {
+	return "git"
+}
+
+func (gitVCS) User() (user Person, err error) {
+	name, err := exec.Command("git", "config", "user.name").Output()
+	if err != nil {
+		return
+	}
+	email, err := exec.Command("git", "config", "user.email").Output()
+	if err != nil {
+		return
+	}
+	return Person{
+		Name:  strings.TrimSpace(string(name)),
+		Email: strings.TrimSpace(string(email)),
+	}, nil
+}
+
+// Releases returns the releases marked by every "v*" tag. Each is
+// authored by the tagger, or by the author of the commit if the tag is
+// not annotated.
+func (gitVCS) Releases() (releases []*vcsRelease, err error) {
+	tags, err := exec.Command("git", "for-each-ref",
+		"--format=%(refname:short)%00%(taggername)%00%(taggeremail)",
+		"refs/tags/v*").Output()
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(tags), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 3 {
+			continue
+		}
+		release := newVCSRelease(fields[0])
+		release.Author = Person{
+			Name:  fields[1],
+			Email: strings.Trim(fields[2], "<>"),
+		}
+
+		count, err := exec.Command("git", "rev-list", "--count",
+			fields[0]).Output()
+		if err != nil {
+			return nil, err
+		}
+		release.Ancestors, err = strconv.Atoi(strings.TrimSpace(string(count)))
+		if err != nil {
+			return nil, err
+		}
+
+		commit, err := exec.Command("git", "log", "-1",
+			"--format=%ct%x00%an%x00%ae", fields[0]).Output()
+		if err != nil {
+			return nil, err
+		}
+		fields = strings.Split(strings.TrimSpace(string(commit)), "\x00")
+		if len(fields) != 3 {
+			return nil, errors.New("git: unexpected log output: " +
+				string(commit))
+		}
+		release.Date, err = gitTime(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(release.Author.Name) == 0 {
+			release.Author = Person{Name: fields[1], Email: fields[2]}
+		}
+		releases = append(releases, release)
+	}
+	return
+}
+
+// Describe uses git describe to find the most recent tag.
+func (gitVCS) Describe() (d *vcsDescription, err error) {
+	d = new(vcsDescription)
+	described, err := exec.Command("git", "describe", "--long", "--tags",
+		"--match=v*").Output()
+	if err == nil {
+		d.Tag, d.Distance, d.ID, err = splitDescription(string(described))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// If there is no tag, every commit is counted.
+		count, err := exec.Command("git", "rev-list", "--count", "HEAD").Output()
+		if err != nil {
+			return nil, err
+		}
+		d.Distance, err = strconv.Atoi(strings.TrimSpace(string(count)))
+		if err != nil {
+			return nil, err
+		}
+		abbrev, err := exec.Command("git", "rev-parse", "--short", "HEAD").Output()
+		if err != nil {
+			return nil, err
+		}
+		d.ID = "g" + strings.TrimSpace(string(abbrev))
+	}
+
+	// Uncommitted changes to tracked files make the working tree
+	// dirty.
+	status, err := exec.Command("git", "status", "--porcelain",
+		"--untracked-files=no").Output()
+	if err != nil {
+		return nil, err
+	}
+	d.Dirty = hasOutput(status)
+
+	timestamp, err := exec.Command("git", "show", "-s", "--format=%ct",
+		"HEAD").Output()
+	if err != nil {
+		return nil, err
+	}
+	d.Date, err = gitTime(string(timestamp))
+	return
+}
+
+// splitDescription splits the output of git describe --long, such as
+// "v1.2.0-5-gabc1234," into the tag, the number of commits since it,
+// and the abbreviated hash. The tag may itself contain hyphens, so it
+// is split from the right.
+func splitDescription(described string) (tag string, distance int, id string, err error) {
+	parts := strings.Split(strings.TrimSpace(described), "-")
+	if len(parts) < 3 {
+		err = errors.New("git: unexpected description: " + described)
+		return
+	}
+	distance, err = strconv.Atoi(parts[len(parts)-2])
+	if err != nil {
+		return
+	}
+	return concat("-", parts[:len(parts)-2]...), distance,
+		parts[len(parts)-1], nil
+}
+
+func (gitVCS) Log(since, until string, merges bool) (commits []vcsCommit, err error) {
+	if len(until) == 0 {
+		until = "HEAD"
+	}
+	if len(since) > 0 {
+		until = since + ".." + until
+	}
+	args := []string{"--no-pager", "log", "--no-merges",
+		"--pretty=format:%B%x1e", until}
+	if merges {
+		args[2] = "--simplify-merges"
+	}
+	logoutput, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return
+	}
+	for _, message := range strings.Split(string(logoutput), "\x1e") {
+		if len(strings.TrimSpace(message)) > 0 {
+			commits = append(commits, newVCSCommit(message))
+		}
+	}
+	return
+}
+
+// gitTime parses a Unix timestamp, as printed by "%ct."
+func gitTime(timestamp string) (t time.Time, err error) {
+	seconds, err := strconv.ParseInt(strings.TrimSpace(timestamp), 10, 64)
+	if err != nil {
+		return
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// hgVCS finds the user, releases, and changes of a Mercurial
+// repository.
+type hgVCS struct{}
+
+func (hgVCS) Name() string {
+	return "hg"
+}
+
+// User parses ui.username, which is of the form "Name <email>."
+func (hgVCS) User() (user Person, err error) {
+	username, err := exec.Command("hg", "config", "ui.username").Output()
+	if err != nil {
+		return
+	}
+	return parsePerson(string(username)), nil
+}
+
+// Releases returns the releases marked by every "v*" tag. Mercurial
+// does not record who made a tag, so each is authored by the author
+// of the tagged changeset.
+func (hgVCS) Releases() (releases []*vcsRelease, err error) {
+	// The template is escaped by Mercurial, so that the fields are
+	// separated by null bytes.
+	tagged, err := exec.Command("hg", "log", "-r", "tag('re:^v')",
+		"--template", `{tags}\x00{rev}\x00{date|hgdate}\x00{author}\n`).Output()
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(tagged), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		rev, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		date, err := hgTime(fields[2])
+		if err != nil {
+			return nil, err
+		}
+
+		// A changeset may have more than one tag, and each which
+		// marks a release is listed.
+		for _, tag := range strings.Fields(fields[0]) {
+			if !strings.HasPrefix(tag, "v") {
+				continue
+			}
+			release := newVCSRelease(tag)
+			release.Date = date
+			release.Ancestors = rev
+			release.Author = parsePerson(fields[3])
+			releases = append(releases, release)
+		}
+	}
+	return
+}
+
+// Describe finds the most recent tag with latesttag.
+func (hgVCS) Describe() (d *vcsDescription, err error) {
+	described, err := exec.Command("hg", "log", "-r", ".", "--template",
+		`{latesttag('re:^v') % '{tag}\x00{distance}'}\x00{node|short}\x00{date|hgdate}`).Output()
+	if err != nil {
+		return
+	}
+	fields := strings.Split(strings.TrimSpace(string(described)), "\x00")
+	if len(fields) != 4 {
+		return nil, errors.New("hg: unexpected description: " +
+			string(described))
+	}
+
+	d = &vcsDescription{Tag: fields[0], ID: fields[2]}
+	if d.Tag == "null" {
+		// If there is no tag, every ancestor is counted.
+		d.Tag = ""
+		ancestors, err := exec.Command("hg", "log", "-r", "::.",
+			"--template", "x").Output()
+		if err != nil {
+			return nil, err
+		}
+		d.Distance = len(ancestors)
+	} else {
+		d.Distance, err = strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	d.Date, err = hgTime(fields[3])
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := exec.Command("hg", "status", "-mard").Output()
+	if err != nil {
+		return nil, err
+	}
+	d.Dirty = hasOutput(status)
+	return
+}
+
+func (hgVCS) Log(since, until string, merges bool) (commits []vcsCommit, err error) {
+	if len(until) == 0 {
+		until = "."
+	}
+	revset := "::" + until
+	if len(since) > 0 {
+		revset += " - ::" + since
+	}
+	if !merges {
+		revset += " and not merge()"
+	}
+	logoutput, err := exec.Command("hg", "log", "-r",
+		"reverse("+revset+")", "--template", `{desc}\x1e`).Output()
+	if err != nil {
+		return
+	}
+	for _, message := range strings.Split(string(logoutput), "\x1e") {
+		if len(strings.TrimSpace(message)) > 0 {
+			commits = append(commits, newVCSCommit(message))
+		}
+	}
+	return
+}
+
+// hgTime parses a date as printed by the "hgdate" filter, which is a
+// Unix timestamp followed by the offset from UTC.
+func hgTime(hgdate string) (t time.Time, err error) {
+	fields := strings.Fields(hgdate)
+	if len(fields) != 2 {
+		return t, errors.New("hg: unexpected date: " + hgdate)
+	}
+	return gitTime(fields[0])
+}
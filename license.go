@@ -0,0 +1,79 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// builtinLicenses are the texts of common licenses, named by their
+// Debian short names, such as "GPL-3+." The licenses whose complete
+// texts are in /usr/share/common-licenses on Debian systems are given
+// as the usual notice, which refers to that file. The texts of license
+// exceptions are in "exceptions," named by their SPDX identifiers.
+//
+//go:embed licenses
+var builtinLicenses embed.FS
+
+// licenseFiles are the names of the files in which projects usually
+// keep their license, in the order in which they are searched for.
+var licenseFiles = []string{
+	"LICENSE", "LICENSE.txt", "LICENSE.md", "LICENCE", "COPYING",
+	"COPYING.txt",
+}
+
+// licenseText returns the text of the single license. If project is
+// set, the license is the only one under which the project is licensed,
+// and the LicenseFile given in the Copyright is used if there is one.
+// Otherwise, the built in text is used, or, for the license of the
+// project, the license file found at the top of the project. It fails
+// if no text is found, since Debian requires the full text of every
+// license that is not in /usr/share/common-licenses.
+func licenseText(license *licenseExpr, project bool, c *Copyright) (string, error) {
+	if project && len(c.LicenseFile) > 0 {
+		text, err := os.ReadFile(c.LicenseFile)
+		return string(text), err
+	}
+
+	text, err := builtinLicenseText(license)
+	if err == nil || !project {
+		return text, err
+	}
+	for _, file := range licenseFiles {
+		text, err := os.ReadFile(file)
+		if err == nil {
+			l.Debugf("Using %q as the text of license %q\n", file, license)
+			return string(text), nil
+		}
+	}
+	return "", errors.New("no text found for license " + license.String() +
+		"; give it in Copyright.LicenseFile or a LICENSE file")
+}
+
+// builtinLicenseText returns the built in text of the single license.
+// The texts are named by the Debian short names of the licenses
+// without their exceptions, so the text of the exception, which is
+// named by its SPDX identifier, is appended to that of the license.
+func builtinLicenseText(license *licenseExpr) (string, error) {
+	base := *license
+	base.Exception = ""
+	text, err := fs.ReadFile(builtinLicenses,
+		path.Join("licenses", debianLicenseName(&base)))
+	if err != nil {
+		return "", errors.New("no text found for license " +
+			license.String() + ", which is not built in")
+	}
+	if len(license.Exception) == 0 {
+		return string(text), nil
+	}
+
+	exception, err := fs.ReadFile(builtinLicenses,
+		path.Join("licenses", "exceptions", license.Exception))
+	if err != nil {
+		return "", errors.New("no text found for license exception " +
+			license.Exception + ", which is not built in")
+	}
+	return string(text) + "\n" + string(exception), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLicenseText(t *testing.T) {
+	inTempDir(t)
+	c := &Copyright{Name: "foo"}
+	tests := []struct {
+		license, prefix, suffix string
+		project, ok             bool
+	}{
+		{"MIT", "Permission is hereby granted", "", false, true},
+		{
+			// The exception is appended to the text of the license.
+			"GPL-2.0-or-later WITH Classpath-exception-2.0",
+			"This program is free software", "from your version.\n",
+			false, true,
+		},
+		{"GPL-3.0-only WITH GCC-exception-3.1", "", "", false, false},
+		{"PostgreSQL", "", "", false, false},
+		{"PostgreSQL", "", "", true, false},
+	}
+	for _, test := range tests {
+		license, err := parseLicense(test.license)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, err := licenseText(license, test.project, c)
+		if (err == nil) != test.ok {
+			t.Errorf("licenseText(%q, %t) error = %v, want ok %t",
+				test.license, test.project, err, test.ok)
+			continue
+		}
+		if !strings.HasPrefix(text, test.prefix) ||
+			!strings.HasSuffix(text, test.suffix) {
+			t.Errorf("licenseText(%q, %t) = %q, want %q...%q",
+				test.license, test.project, text, test.prefix, test.suffix)
+		}
+	}
+}
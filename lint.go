@@ -0,0 +1,637 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A lintSeverity indicates how serious a lint problem is. Warnings
+// are reported, but only errors cause lint to fail.
+type lintSeverity int
+
+const (
+	lintWarning lintSeverity = iota
+	lintError
+)
+
+func (s lintSeverity) String() string {
+	if s == lintError {
+		return "error"
+	}
+	return "warning"
+}
+
+// A lintProblem is a single problem found in a Package, along with
+// the path of the field in which it was found, such as
+// "Packages[1].Depends[0]".
+type lintProblem struct {
+	Path     string
+	Severity lintSeverity
+	Message  string
+}
+
+func (p lintProblem) String() string {
+	return p.Path + ": " + p.Severity.String() + ": " + p.Message
+}
+
+var (
+	// lintName matches valid package names, as described in Debian
+	// Policy 5.6.1.
+	lintName = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+
+	// lintVersion matches valid versions, with an optional epoch, as
+	// described in Debian Policy 5.6.12.
+	lintVersion = regexp.MustCompile(`^([0-9]+:)?[0-9][A-Za-z0-9.+~:-]*$`)
+
+	// lintYears matches a list of years and year ranges, such as
+	// "2013-2015, 2017."
+	lintYears = regexp.MustCompile(`^\d{4}(-\d{4})?(, *\d{4}(-\d{4})?)*$`)
+
+	// lintProfile matches build profile names, such as "nocheck" or
+	// "pkg.foo.bar," which may be negated with "!."
+	lintProfile = regexp.MustCompile(`^!?[a-z0-9][a-z0-9.+-]*$`)
+
+	// lintEmail matches anything which looks like an email address.
+	lintEmail = regexp.MustCompile(`^[^@\s<>]+@[^@\s<>]+\.[^@\s<>]+$`)
+)
+
+// lintPriorities are the valid values of Priority. "extra" is also
+// accepted, but is deprecated in favor of "optional."
+var lintPriorities = []string{"required", "important", "standard", "optional"}
+
+// lintSections are the sections of the Debian archive, which may be
+// prefixed with the archive area, such as "contrib/net."
+var lintSections = []string{
+	"admin", "cli-mono", "comm", "database", "debug", "devel", "doc",
+	"editors", "education", "electronics", "embedded", "fonts", "games",
+	"gnome", "gnu-r", "gnustep", "golang", "graphics", "hamradio",
+	"haskell", "httpd", "interpreters", "introspection", "java",
+	"javascript", "kde", "kernel", "libdevel", "libs", "lisp",
+	"localization", "mail", "math", "metapackages", "misc", "net",
+	"news", "ocaml", "oldlibs", "otherosfs", "perl", "php", "python",
+	"ruby", "rust", "science", "shells", "sound", "tasks", "tex",
+	"text", "utils", "vcs", "video", "web", "x11", "xfce", "zope",
+}
+
+// lintAreas are the archive areas which may prefix a section.
+var lintAreas = []string{"main", "contrib", "non-free", "non-free-firmware"}
+
+// lintArchitectures are the Debian architectures which may be given
+// in addition to "all," "any," and wildcards such as "linux-any."
+var lintArchitectures = []string{
+	"amd64", "arm64", "armel", "armhf", "i386", "mips64el", "mipsel",
+	"ppc64el", "riscv64", "s390x", "loong64", "alpha", "hppa",
+	"hurd-i386", "hurd-amd64", "m68k", "powerpc", "ppc64", "sh4",
+	"sparc64", "x32",
+}
+
+// A linter collects the problems found in a Package.
+type linter struct {
+	problems []lintProblem
+
+	// p is the Package which is checked, whose PackageNames are used
+	// to resolve logical package names.
+	p *Package
+}
+
+// lintPackage checks the Package against packaging policy, and
+// returns every problem found, sorted by path.
+func lintPackage(p *Package) []lintProblem {
+	lt := &linter{p: p}
+
+	lt.name("ProjectName", p.ProjectName)
+	lt.required("Description", p.Description)
+	lt.person("Maintainer", p.Maintainer)
+	for i, owner := range p.ProjectOwners {
+		lt.person(fmt.Sprintf("ProjectOwners[%d]", i), owner)
+	}
+	if len(p.Homepage) > 0 {
+		lt.homepage("Homepage", p.Homepage)
+	}
+	if len(p.Version) > 0 && !lintVersion.MatchString(p.Version) {
+		lt.errorf("Version", "%q is not a valid version; it must begin "+
+			"with a digit", p.Version)
+	}
+	if p.Epoch < 0 {
+		lt.errorf("Epoch", "must not be negative")
+	}
+
+	if p.Copyright == nil {
+		lt.errorf("Copyright", "missing")
+	} else {
+		lt.license("Copyright.License", p.Copyright.License)
+		if len(p.Copyright.LicenseFile) > 0 {
+			lt.file("Copyright.LicenseFile", p.Copyright.LicenseFile)
+		}
+		for i, f := range p.Copyright.Files {
+			path := fmt.Sprintf("Copyright.Files[%d]", i)
+			lt.required(path+".Glob", f.Glob)
+			lt.license(path+".License", f.License)
+			if len(f.Years) > 0 && !lintYears.MatchString(f.Years) {
+				lt.errorf(path+".Years", "%q is not a list of years or "+
+					"year ranges, such as \"2013-2015, 2017\"", f.Years)
+			}
+		}
+		if len(p.Copyright.Homepage) > 0 {
+			lt.homepage("Copyright.Homepage", p.Copyright.Homepage)
+		}
+	}
+
+	if p.Build != nil && len(p.Build.System) > 0 {
+		var names []string
+		for _, bs := range buildSystems {
+			names = append(names, bs.Name)
+		}
+		if !contains(names, p.Build.System) {
+			lt.errorf("Build.System", "%q is not a known build system; "+
+				"it must be one of %s", p.Build.System, concat(", ", names...))
+		}
+	}
+	if p.Build != nil && p.Build.Shlibs != nil {
+		if r := p.Build.Shlibs.Resolver; len(r) > 0 {
+			if _, ok := shlibResolvers[r]; !ok {
+				lt.errorf("Build.Shlibs.Resolver", "%q is not a known "+
+					"resolver; it must be one of dpkg, rpm, file", r)
+			} else if r == "file" && len(p.Build.Shlibs.File) == 0 {
+				lt.errorf("Build.Shlibs.File", "missing")
+			}
+		}
+		if len(p.Build.Shlibs.File) > 0 {
+			lt.file("Build.Shlibs.File", p.Build.Shlibs.File)
+		}
+	}
+	if p.Build != nil {
+		var types []string
+		for packageType := range p.Build.Requirements {
+			types = append(types, packageType)
+		}
+		sort.Strings(types)
+		for _, packageType := range types {
+			path := "Build.Requirements." + packageType
+			if _, ok := requirementTables[packageType]; !ok {
+				lt.errorf(path, "%q is not a known package type", packageType)
+			}
+			var names []string
+			for name := range p.Build.Requirements[packageType] {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			// Relations are checked with a version filled in for
+			// $VERSION.
+			for _, name := range names {
+				pkgs := p.Build.Requirements[packageType][name]
+				if pkgs == nil {
+					continue
+				}
+				req := requirement{Name: name, Version: "0"}
+				lt.relations(path+"."+name+".BuildDepends",
+					req.relations(pkgs.BuildDepends), true)
+				lt.relations(path+"."+name+".Depends",
+					req.relations(pkgs.Depends), false)
+			}
+		}
+	}
+
+	lt.priority("Priority", p.Priority)
+	lt.section("Section", p.Section)
+	lt.relations("BuildDepends", p.BuildDepends, true)
+	for i, r := range p.BuildDepends {
+		if r.Name == "debhelper-compat" && p.DebhelperCompat != 0 {
+			lt.warningf(fmt.Sprintf("BuildDepends[%d]", i), "overrides "+
+				"DebhelperCompat; only one should be given")
+		}
+	}
+	if p.DebhelperCompat != 0 && p.DebhelperCompat < 9 {
+		lt.errorf("DebhelperCompat", "must be at least 9, the first "+
+			"level which may be given as debhelper-compat")
+	} else if p.DebhelperCompat != 0 && p.DebhelperCompat < 11 {
+		for _, b := range p.Binaries() {
+			if len(b.Services) > 0 {
+				lt.warningf("DebhelperCompat", "must be at least 11 "+
+					"for dh to install the Services of %s", b.Name)
+			}
+		}
+	}
+	lt.packageNames(p.PackageNames)
+
+	// The binary package fields are checked at the top level if
+	// there are no Packages, and are otherwise ignored.
+	if len(p.Packages) == 0 {
+		lt.binary("", p.Binaries()[0])
+	} else {
+		for field, given := range map[string]bool{
+			"Depends":    len(p.Depends) > 0,
+			"Recommends": len(p.Recommends) > 0,
+			"Suggests":   len(p.Suggests) > 0,
+			"Conflicts":  len(p.Conflicts) > 0,
+			"Provides":   len(p.Provides) > 0,
+			"Replaces":   len(p.Replaces) > 0,
+			"Install":    len(p.Install) > 0,
+			"Docs":       len(p.Docs) > 0,
+			"ManPages":   len(p.ManPages) > 0,
+			"InitScript": len(p.InitScript) > 0,
+			"Services":   len(p.Services) > 0,
+		} {
+			if given {
+				lt.warningf(field, "ignored because Packages is given")
+			}
+		}
+		for i, b := range p.Packages {
+			lt.binary(fmt.Sprintf("Packages[%d].", i), b)
+		}
+	}
+
+	lt.placeholders(p)
+
+	sort.SliceStable(lt.problems, func(i, j int) bool {
+		return lt.problems[i].Path < lt.problems[j].Path
+	})
+	return lt.problems
+}
+
+func (lt *linter) errorf(path, format string, args ...interface{}) {
+	lt.problems = append(lt.problems,
+		lintProblem{path, lintError, fmt.Sprintf(format, args...)})
+}
+
+func (lt *linter) warningf(path, format string, args ...interface{}) {
+	lt.problems = append(lt.problems,
+		lintProblem{path, lintWarning, fmt.Sprintf(format, args...)})
+}
+
+// binary checks the fields of a binary package. The prefix is
+// prepended to the name of each field.
+func (lt *linter) binary(prefix string, b *BinaryPackage) {
+	if len(prefix) > 0 {
+		lt.name(prefix+"Name", b.Name)
+		lt.required(prefix+"Description", b.Description)
+	}
+
+	if len(b.Architecture) > 0 || len(prefix) == 0 {
+		lt.architecture(prefix+"Architecture", b.Architecture)
+	}
+
+	lt.relations(prefix+"Depends", b.Depends, false)
+	lt.relations(prefix+"Recommends", b.Recommends, false)
+	lt.relations(prefix+"Suggests", b.Suggests, false)
+	lt.relations(prefix+"Conflicts", b.Conflicts, false)
+	lt.relations(prefix+"Provides", b.Provides, false)
+	lt.relations(prefix+"Replaces", b.Replaces, false)
+
+	for i, line := range b.Install {
+		lt.install(fmt.Sprintf("%sInstall[%d]", prefix, i), line)
+	}
+	for i, doc := range b.Docs {
+		lt.file(fmt.Sprintf("%sDocs[%d]", prefix, i), doc)
+	}
+	for i, page := range b.ManPages {
+		lt.file(fmt.Sprintf("%sManPages[%d]", prefix, i), page)
+	}
+	if len(b.InitScript) > 0 {
+		lt.file(prefix+"InitScript", b.InitScript)
+	}
+
+	for i, s := range b.Services {
+		path := fmt.Sprintf("%sServices[%d]", prefix, i)
+		switch {
+		case len(s.File) > 0:
+			lt.file(path+".File", s.File)
+		case len(s.ExecStart) == 0:
+			lt.errorf(path, "neither File nor ExecStart is given")
+		}
+	}
+
+	for name, s := range map[string]*Script{
+		"PreInst": b.PreInst, "PostInst": b.PostInst,
+		"PreRm": b.PreRm, "PostRm": b.PostRm,
+	} {
+		if s != nil && len(s.File) > 0 {
+			lt.file(prefix+name+".File", s.File)
+		}
+	}
+}
+
+// required reports an error if the value is empty.
+func (lt *linter) required(path, value string) {
+	if len(strings.TrimSpace(value)) == 0 {
+		lt.errorf(path, "missing")
+	}
+}
+
+// name checks that the value is a valid package name.
+func (lt *linter) name(path, value string) {
+	switch {
+	case len(value) == 0:
+		lt.errorf(path, "missing")
+	case !lintName.MatchString(value):
+		lt.errorf(path, "%q is not a valid package name; it must be at "+
+			"least two characters of lowercase letters, digits, and "+
+			"\"+-.\", and begin with a letter or digit", value)
+	}
+}
+
+// person checks that the person has a name and a valid email
+// address.
+func (lt *linter) person(path string, person Person) {
+	lt.required(path+".Name", person.Name)
+	switch {
+	case len(person.Email) == 0:
+		lt.errorf(path+".Email", "missing")
+	case !lintEmail.MatchString(person.Email):
+		lt.errorf(path+".Email", "%q is not an email address", person.Email)
+	}
+	if len(person.Years) > 0 && !lintYears.MatchString(person.Years) {
+		lt.errorf(path+".Years", "%q is not a list of years or year "+
+			"ranges, such as \"2013-2015, 2017\"", person.Years)
+	}
+}
+
+// license checks that the value is a valid SPDX license expression
+// made up of known licenses, and suggests its canonical form if it is
+// not already given in it. Placeholders are left to placeholders().
+func (lt *linter) license(path, value string) {
+	if len(strings.TrimSpace(value)) == 0 {
+		lt.errorf(path, "missing")
+		return
+	}
+	if isPlaceholder(value) {
+		return
+	}
+	license, err := parseLicense(value)
+	switch {
+	case err != nil:
+		lt.errorf(path, "%q is not a valid SPDX license expression: %s",
+			value, err)
+	case license.String() != value:
+		lt.warningf(path, "%q should be given as %q", value, license)
+	}
+}
+
+// homepage checks that the value is an HTTP or HTTPS URL.
+func (lt *linter) homepage(path, value string) {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+		len(u.Host) == 0 {
+		lt.errorf(path, "%q is not an http or https URL", value)
+	}
+}
+
+// priority checks that the value is a known priority.
+func (lt *linter) priority(path, value string) {
+	if len(value) == 0 {
+		lt.warningf(path, "missing; \"optional\" is usual")
+		return
+	}
+	switch {
+	case value == "extra":
+		lt.warningf(path, "%q is deprecated; use \"optional\"", value)
+	case !contains(lintPriorities, value):
+		lt.errorf(path, "%q is not a valid priority", value)
+	}
+}
+
+// section checks that the value is a known section, optionally
+// prefixed with an archive area.
+func (lt *linter) section(path, value string) {
+	if len(value) == 0 {
+		lt.warningf(path, "missing")
+		return
+	}
+	section := value
+	if i := strings.Index(value, "/"); i >= 0 {
+		if !contains(lintAreas, value[:i]) {
+			lt.warningf(path, "%q is not a known archive area", value[:i])
+		}
+		section = value[i+1:]
+	}
+	if !contains(lintSections, section) {
+		lt.warningf(path, "%q is not a known section", section)
+	}
+}
+
+// architecture checks that each space separated architecture in the
+// value is known.
+func (lt *linter) architecture(path, value string) {
+	if len(value) == 0 {
+		lt.warningf(path, "missing; \"any\" is assumed")
+		return
+	}
+	for _, arch := range strings.Fields(value) {
+		switch {
+		case arch == "all" || arch == "any":
+		case strings.HasSuffix(arch, "-any"), strings.HasPrefix(arch, "any-"):
+		case contains(lintArchitectures, arch):
+		default:
+			lt.errorf(path, "%q is not a known architecture", arch)
+		}
+	}
+}
+
+// relations checks that each relation is made up of well-formed
+// alternatives, such as "libc6 (>= 2.3) | libc6.1". Alternatives are
+// warned about, since only the first is kept in PKGBUILDs.
+// Architecture restrictions and build profiles are only allowed if
+// build is set, since they only apply to build dependencies.
+func (lt *linter) relations(field string, relations []Relation, build bool) {
+	for i, relation := range relations {
+		path := fmt.Sprintf("%s[%d]", field, i)
+		if isPlaceholder(relation.Name) {
+			// Placeholders are reported separately.
+			continue
+		}
+		if len(relation.Alternatives) > 0 {
+			lt.warningf(path, "alternatives are not supported in "+
+				"PKGBUILDs, so only %q is kept for Arch Linux",
+				relation.Choices()[0])
+			lt.alternatives(path, relation)
+		}
+		for _, choice := range relation.Choices() {
+			// Names may be qualified with an architecture, as in
+			// "python3:any."
+			if !lintName.MatchString(choice.Package()) {
+				lt.errorf(path, "%q is not a valid package name", choice.Name)
+			}
+			if len(choice.Op) > 0 || len(choice.Version) > 0 {
+				if !contains(relationOperators, choice.Op) {
+					lt.errorf(path, "%q is not a valid relation operator in %q",
+						choice.Op, choice)
+				}
+				if !lintVersion.MatchString(choice.Version) {
+					lt.errorf(path, "%q is not a valid version in %q",
+						choice.Version, choice)
+				}
+			}
+
+			if !build && (len(choice.Arch) > 0 || len(choice.Profiles) > 0) {
+				lt.errorf(path, "architecture restrictions and build "+
+					"profiles are only allowed in BuildDepends")
+				continue
+			}
+			negated := 0
+			for _, arch := range choice.Arch {
+				if strings.HasPrefix(arch, "!") {
+					negated++
+				}
+				arch = strings.TrimPrefix(arch, "!")
+				if arch != "any" && !strings.HasSuffix(arch, "-any") &&
+					!strings.HasPrefix(arch, "any-") &&
+					!contains(lintArchitectures, arch) {
+					lt.errorf(path, "%q is not a known architecture", arch)
+				}
+			}
+			if negated > 0 && negated < len(choice.Arch) {
+				lt.errorf(path, "architectures in %q must be either all "+
+					"negated or none", choice)
+			}
+			for _, formula := range choice.Profiles {
+				if len(formula) == 0 {
+					lt.errorf(path, "empty build profile formula in %q", choice)
+				}
+				for _, profile := range formula {
+					if !lintProfile.MatchString(profile) {
+						lt.errorf(path, "%q is not a valid build profile",
+							profile)
+					}
+				}
+			}
+		}
+	}
+}
+
+// alternatives checks that none of the alternatives of the relation is
+// a logical package name which maps to several packages, since only the
+// first of them can be kept as an alternative.
+func (lt *linter) alternatives(path string, relation Relation) {
+	var types []string
+	for packageType := range requirementTables {
+		types = append(types, packageType)
+	}
+	sort.Strings(types)
+	for _, choice := range relation.Choices() {
+		for _, packageType := range types {
+			mapped, _ := lt.p.packageName(packageType, choice.Name)
+			if len(mapped) > 1 {
+				lt.errorf(path, "%q maps to several packages for %s, so "+
+					"it cannot be one of several alternatives", choice.Name,
+					packageType)
+				break
+			}
+		}
+	}
+}
+
+// packageNames checks that the logical package names are mapped for
+// known package types to valid relations.
+func (lt *linter) packageNames(names map[string]map[string][]Relation) {
+	var logical []string
+	for name := range names {
+		logical = append(logical, name)
+	}
+	sort.Strings(logical)
+	for _, name := range logical {
+		path := "PackageNames." + name
+		if !lintName.MatchString(name) {
+			lt.errorf(path, "%q is not a valid package name", name)
+		}
+		var types []string
+		for packageType := range names[name] {
+			types = append(types, packageType)
+		}
+		sort.Strings(types)
+		for _, packageType := range types {
+			if _, ok := requirementTables[packageType]; !ok {
+				lt.errorf(path+"."+packageType, "%q is not a known "+
+					"package type", packageType)
+			}
+			lt.relations(path+"."+packageType, names[name][packageType], true)
+		}
+	}
+}
+
+// install checks that the Install line is made up of a source glob
+// and a target directory, and that the glob matches some files.
+func (lt *linter) install(path, line string) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		lt.errorf(path, "%q must be a source path or glob and a target "+
+			"directory", line)
+		return
+	}
+	if strings.HasPrefix(fields[1], "/") {
+		lt.warningf(path, "target %q should not begin with \"/\"", fields[1])
+	}
+	matches, err := filepath.Glob(fields[0])
+	switch {
+	case err != nil:
+		lt.errorf(path, "%q is not a valid glob: %s", fields[0], err)
+	case len(matches) == 0:
+		// The files may not have been built yet, so this is only a
+		// warning.
+		lt.warningf(path, "%q does not match any files", fields[0])
+	}
+}
+
+// file reports a warning if the file does not exist.
+func (lt *linter) file(path, filename string) {
+	if isPlaceholder(filename) {
+		return
+	}
+	if _, err := os.Stat(filename); err != nil {
+		lt.warningf(path, "%q does not exist", filename)
+	}
+}
+
+// placeholders reports an error for every value in the Package which
+// was left as a placeholder from templatePackage().
+func (lt *linter) placeholders(p *Package) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return
+	}
+	var v interface{}
+	json.Unmarshal(b, &v)
+
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for key, child := range v {
+				if len(path) > 0 {
+					key = path + "." + key
+				}
+				walk(key, child)
+			}
+		case []interface{}:
+			for i, child := range v {
+				walk(fmt.Sprintf("%s[%d]", path, i), child)
+			}
+		case string:
+			if isPlaceholder(v) {
+				lt.errorf(path, "%q is placeholder text from the template", v)
+			}
+		}
+	}
+	walk("", v)
+}
+
+// isPlaceholder returns true if the value is one of the placeholders
+// used by templatePackage().
+func isPlaceholder(value string) bool {
+	return contains(templatePlaceholders, value)
+}
+
+// contains returns true if the item is in the list.
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// lintTestPackage returns a Package with no lint problems.
+func lintTestPackage() *Package {
+	maintainer := Person{Name: "Jane Doe", Email: "jane@example.com"}
+	return &Package{
+		ProjectName:   "foo",
+		ProjectOwners: []Person{maintainer},
+		Maintainer:    maintainer,
+		Description:   "does foo things",
+		Homepage:      "https://example.com/foo",
+		Copyright:     &Copyright{Name: "foo", License: "MIT"},
+		Depends:       mustParseRelations("libc6 (>= 2.34)", "python3:any"),
+		Section:       "utils",
+		Priority:      "optional",
+		Architecture:  "any",
+	}
+}
+
+func TestLintPackage(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *Package)
+		want   []string
+	}{
+		{"valid", func(p *Package) {}, nil},
+		{
+			"missing fields",
+			func(p *Package) {
+				p.ProjectName = ""
+				p.Description = " "
+				p.Copyright = nil
+			},
+			[]string{"Copyright: error", "Description: error",
+				"ProjectName: error"},
+		},
+		{
+			"invalid name",
+			func(p *Package) { p.ProjectName = "Foo_Bar" },
+			[]string{"ProjectName: error"},
+		},
+		{
+			"invalid people",
+			func(p *Package) {
+				p.Maintainer.Email = "jane"
+				p.ProjectOwners = append(p.ProjectOwners, Person{})
+			},
+			[]string{"Maintainer.Email: error",
+				"ProjectOwners[1].Email: error", "ProjectOwners[1].Name: error"},
+		},
+		{
+			"invalid homepage",
+			func(p *Package) { p.Homepage = "ftp://example.com" },
+			[]string{"Homepage: error"},
+		},
+		{
+			"version",
+			func(p *Package) {
+				p.Version = "v1.0"
+				p.Epoch = -1
+			},
+			[]string{"Epoch: error", "Version: error"},
+		},
+		{
+			"priority and section",
+			func(p *Package) {
+				p.Priority = "extra"
+				p.Section = "bogus/utils"
+			},
+			[]string{"Priority: warning", "Section: warning"},
+		},
+		{
+			"area",
+			func(p *Package) { p.Section = "contrib/net" },
+			nil,
+		},
+		{
+			"architecture",
+			func(p *Package) { p.Architecture = "amd64 linux-any any-arm64 vax" },
+			[]string{"Architecture: error"},
+		},
+		{
+			"relations",
+			func(p *Package) {
+				p.Depends = []Relation{{Name: "Foo"},
+					{Name: "bar", Op: "<>", Version: "1"},
+					{Name: "baz", Op: ">=", Version: "x"},
+					{Name: "qux", Arch: []string{"amd64"}}}
+				p.BuildDepends = mustParseRelations("qux [amd64 !i386]",
+					"quux [vax] <nocheck>")
+			},
+			[]string{"BuildDepends[0]: error", "BuildDepends[1]: error",
+				"Depends[0]: error", "Depends[1]: error", "Depends[2]: error",
+				"Depends[3]: error"},
+		},
+		{
+			"alternatives",
+			func(p *Package) { p.Depends = mustParseRelations("libc6 | libc6.1") },
+			[]string{"Depends[0]: warning"},
+		},
+		{
+			"logical names in alternatives",
+			func(p *Package) {
+				p.Depends = mustParseRelations("openssl-runtime | libssl1.1",
+					"rust-compiler | foo")
+			},
+			[]string{"Depends[0]: warning", "Depends[1]: warning",
+				"Depends[1]: error"},
+		},
+		{
+			"placeholders",
+			func(p *Package) {
+				p.Copyright.License = placeholderLicense
+				p.BuildDepends = []Relation{{Name: placeholderBuildDepends}}
+			},
+			[]string{"BuildDepends[0]: error", "Copyright.License: error"},
+		},
+		{
+			"ignored fields",
+			func(p *Package) {
+				p.Packages = []*BinaryPackage{{Name: "foo",
+					Description: "does foo things"}}
+			},
+			[]string{"Depends: warning"},
+		},
+		{
+			"binary packages",
+			func(p *Package) {
+				p.Depends = nil
+				p.Packages = []*BinaryPackage{
+					{Name: "foo", Description: "does foo things",
+						Architecture: "mips"},
+					{Name: "x", Depends: []Relation{{Name: "foo", Op: "="}},
+						Services: []*Service{{}}},
+				}
+			},
+			[]string{"Packages[0].Architecture: error",
+				"Packages[1].Depends[0]: error",
+				"Packages[1].Description: error", "Packages[1].Name: error",
+				"Packages[1].Services[0]: error"},
+		},
+		{
+			"missing files",
+			func(p *Package) {
+				p.Docs = []string{"does-not-exist"}
+				p.ManPages = []string{placeholderManPage}
+			},
+			[]string{"Docs[0]: warning", "ManPages[0]: error"},
+		},
+	}
+	for _, test := range tests {
+		p := lintTestPackage()
+		test.modify(p)
+		var got []string
+		for _, problem := range lintPackage(p) {
+			got = append(got, problem.Path+": "+problem.Severity.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: lintPackage() = %q, want %q", test.name, got,
+				test.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+// packageNames map logical package names, which name a requirement
+// once for every distribution, to the packages which satisfy it for
+// each package type. A logical name may map to several packages, or to
+// none where the requirement is always met, as where a distribution
+// ships it in a package which is always installed.
+var packageNames = map[string]map[string][]Relation{
+	"libc-runtime":    logicalName("libc6", "glibc", "glibc"),
+	"openssl-runtime": logicalName("libssl3", "openssl-libs", "openssl"),
+	"openssl-dev":     logicalName("libssl-dev", "openssl-devel", "openssl"),
+	"zlib-runtime":    logicalName("zlib1g", "zlib", "zlib"),
+	"zlib-dev":        logicalName("zlib1g-dev", "zlib-devel", "zlib"),
+	"curl-runtime":    logicalName("libcurl4", "libcurl", "curl"),
+	"curl-dev":        logicalName("libcurl4-openssl-dev", "libcurl-devel", "curl"),
+	"sqlite-runtime":  logicalName("libsqlite3-0", "sqlite-libs", "sqlite"),
+	"sqlite-dev":      logicalName("libsqlite3-dev", "sqlite-devel", "sqlite"),
+	"python3-runtime": logicalName("python3", "python3", "python"),
+	"python3-dev":     logicalName("python3-dev", "python3-devel", "python"),
+	"go-compiler":     logicalName("golang-go", "golang", "go"),
+	"rust-compiler":   logicalName("cargo, rustc", "cargo, rust", "rust"),
+	"c-compiler":      logicalName("gcc", "gcc", "gcc"),
+	"c++-compiler":    logicalName("g++", "gcc-c++", "gcc"),
+	"pkg-config":      logicalName("pkgconf", "pkgconf-pkg-config", "pkgconf"),
+}
+
+// logicalName creates the entry of a logical name from the packages
+// which satisfy it for each package type, each given as a list of
+// relations separated by commas.
+func logicalName(deb, rpm, arch string) map[string][]Relation {
+	split := func(s string) []Relation {
+		relations, err := parseRelations(s)
+		if err != nil {
+			panic(err)
+		}
+		if relations == nil {
+			return []Relation{}
+		}
+		return relations
+	}
+	return map[string][]Relation{
+		"deb":  split(deb),
+		"rpm":  split(rpm),
+		"arch": split(arch),
+	}
+}
+
+// packageName returns the packages which satisfy the logical name for
+// the given package type. The PackageNames of the Package replace the
+// built in entries for the same name and package type. If the name is
+// not mapped for the package type, ok is false.
+func (p *Package) packageName(packageType, name string) (relations []Relation, ok bool) {
+	relations, ok = p.PackageNames[name][packageType]
+	if !ok {
+		relations, ok = packageNames[name][packageType]
+	}
+	return
+}
+
+// resolveRelations replaces the logical names in the given relations
+// with the packages which satisfy them for the given package type. A
+// version given with a logical name applies to each package which has
+// none of its own. A relation on a logical name which maps to several
+// packages becomes a relation on each of them, except within
+// alternatives, where only the first is used, and a warning is given
+// for the others. Relations on names which are not mapped are kept as
+// they are, and those which map to no packages are dropped. The given
+// slice is not modified.
+func (p *Package) resolveRelations(packageType string, relations []Relation) (resolved []Relation) {
+	if relations == nil {
+		return nil
+	}
+	resolved = make([]Relation, 0, len(relations))
+	for _, relation := range relations {
+		choices := relation.Choices()
+		if len(choices) == 1 {
+			resolved = append(resolved, p.resolveChoice(packageType, relation)...)
+			continue
+		}
+
+		var r *Relation
+		for _, choice := range choices {
+			mapped := p.resolveChoice(packageType, choice)
+			if len(mapped) > 1 {
+				l.Warningf("%q maps to several packages for %s, so only "+
+					"%q is kept as an alternative in %q\n", choice.Name,
+					packageType, mapped[0], relation)
+			}
+			switch {
+			case len(mapped) == 0:
+				continue
+			case r == nil:
+				// The alternatives are copied so that those of the
+				// mapped relation are not modified.
+				r = &mapped[0]
+				r.Alternatives = append([]Relation(nil), r.Alternatives...)
+			default:
+				r.Alternatives = append(r.Alternatives, mapped[0])
+			}
+		}
+		if r != nil {
+			resolved = append(resolved, *r)
+		}
+	}
+	return
+}
+
+// resolveChoice maps a single alternative of a relation.
+func (p *Package) resolveChoice(packageType string, choice Relation) []Relation {
+	mapped, ok := p.packageName(packageType, choice.Name)
+	if !ok {
+		return []Relation{choice}
+	}
+	l.Debugf("Mapped %q to %q for %s\n", choice.Name,
+		debianRelations(mapped), packageType)
+
+	resolved := make([]Relation, len(mapped))
+	for i, r := range mapped {
+		if len(r.Op) == 0 {
+			r.Op, r.Version = choice.Op, choice.Version
+		}
+		if len(r.Arch) == 0 {
+			r.Arch = choice.Arch
+		}
+		if len(r.Profiles) == 0 {
+			r.Profiles = choice.Profiles
+		}
+		resolved[i] = r
+	}
+	return resolved
+}
+
+// resolveNames returns a copy of the Package in which the logical
+// names in every relation are resolved for the given package type, so
+// that each Frameworker sees only the names of its own distribution.
+func (p *Package) resolveNames(packageType string) *Package {
+	resolved := *p
+	resolved.BuildDepends = p.resolveRelations(packageType, p.BuildDepends)
+	resolved.Depends = p.resolveRelations(packageType, p.Depends)
+	resolved.Recommends = p.resolveRelations(packageType, p.Recommends)
+	resolved.Suggests = p.resolveRelations(packageType, p.Suggests)
+	resolved.Conflicts = p.resolveRelations(packageType, p.Conflicts)
+	resolved.Provides = p.resolveRelations(packageType, p.Provides)
+	resolved.Replaces = p.resolveRelations(packageType, p.Replaces)
+
+	if len(p.Packages) > 0 {
+		resolved.Packages = make([]*BinaryPackage, len(p.Packages))
+	}
+	for i, b := range p.Packages {
+		binary := *b
+		binary.Depends = p.resolveRelations(packageType, b.Depends)
+		binary.Recommends = p.resolveRelations(packageType, b.Recommends)
+		binary.Suggests = p.resolveRelations(packageType, b.Suggests)
+		binary.Conflicts = p.resolveRelations(packageType, b.Conflicts)
+		binary.Provides = p.resolveRelations(packageType, b.Provides)
+		binary.Replaces = p.resolveRelations(packageType, b.Replaces)
+		resolved.Packages[i] = &binary
+	}
+	return &resolved
+}
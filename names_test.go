@@ -0,0 +1,94 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveRelations(t *testing.T) {
+	p := &Package{PackageNames: map[string]map[string][]Relation{
+		"c-compiler": {"deb": mustParseRelations("clang (>= 14)")},
+		"always":     {"deb": {}},
+	}}
+	tests := []struct {
+		packageType, in string
+		want            []string
+	}{
+		// Versions and restrictions apply to packages with none of
+		// their own.
+		{"deb", "libc-runtime (>= 2.34)", []string{"libc6 (>= 2.34)"}},
+		{"rpm", "libc-runtime (>= 2.34)", []string{"glibc (>= 2.34)"}},
+		{"deb", "zlib-dev [linux-any] <!nocheck>",
+			[]string{"zlib1g-dev [linux-any] <!nocheck>"}},
+		{"deb", "rust-compiler (>= 1.70)",
+			[]string{"cargo (>= 1.70)", "rustc (>= 1.70)"}},
+		{"deb", "unmapped (>= 1)", []string{"unmapped (>= 1)"}},
+
+		// PackageNames replace the built in entries for their package
+		// types only.
+		{"deb", "c-compiler (>= 10)", []string{"clang (>= 14)"}},
+		{"rpm", "c-compiler (>= 10)", []string{"gcc (>= 10)"}},
+		{"deb", "always", []string{}},
+
+		// Within alternatives, only the first package is kept.
+		{"deb", "openssl-runtime | libssl1.1", []string{"libssl3 | libssl1.1"}},
+		{"deb", "rust-compiler | foo", []string{"cargo | foo"}},
+		{"deb", "always | foo", []string{"foo"}},
+	}
+	for _, test := range tests {
+		relations := mustParseRelations(test.in)
+		resolved := p.resolveRelations(test.packageType, relations)
+		got := []string{}
+		for _, r := range resolved {
+			got = append(got, r.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("resolveRelations(%q, %q) = %q, want %q",
+				test.packageType, test.in, got, test.want)
+		}
+		if relations[0].String() != test.in {
+			t.Errorf("resolveRelations(%q, %q) modified the relation to %q",
+				test.packageType, test.in, relations[0])
+		}
+	}
+
+	if resolved := p.resolveRelations("deb", nil); resolved != nil {
+		t.Errorf("resolveRelations(%q, nil) = %q, want nil", "deb", resolved)
+	}
+}
+
+func TestResolveNames(t *testing.T) {
+	p := &Package{
+		BuildDepends: mustParseRelations("go-compiler (>= 2:1.21~)"),
+		Depends:      mustParseRelations("libc-runtime"),
+		Packages: []*BinaryPackage{
+			{Name: "foo", Depends: mustParseRelations("sqlite-runtime (>= 3.40)")},
+			{Name: "foo-dev", Depends: mustParseRelations("sqlite-dev", "foo")},
+		},
+		PackageNames: map[string]map[string][]Relation{
+			"sqlite-runtime": {"rpm": mustParseRelations("sqlite")},
+		},
+	}
+	resolved := p.resolveNames("rpm")
+	want := map[string]string{
+		"BuildDepends":        "golang (>= 2:1.21~)",
+		"Depends":             "glibc",
+		"Packages[0].Depends": "sqlite (>= 3.40)",
+		"Packages[1].Depends": "sqlite-devel, foo",
+	}
+	got := map[string]string{
+		"BuildDepends":        debianRelations(resolved.BuildDepends),
+		"Depends":             debianRelations(resolved.Depends),
+		"Packages[0].Depends": debianRelations(resolved.Packages[0].Depends),
+		"Packages[1].Depends": debianRelations(resolved.Packages[1].Depends),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("resolveNames(%q) = %q, want %q", "rpm", got, want)
+	}
+
+	// The Package itself is left with its logical names.
+	if s := debianRelations(p.Packages[0].Depends); s != "sqlite-runtime (>= 3.40)" {
+		t.Errorf("resolveNames(%q) modified Packages[0].Depends to %q",
+			"rpm", s)
+	}
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
-	"os/exec"
 	"path"
+	"strings"
 	"time"
 )
 
@@ -24,12 +25,23 @@ type Frameworker interface {
 	Framework(*Package) error
 }
 
+// A Builder is a type which is capable of creating the distributable
+// package itself, without relying on any external packaging tools.
+type Builder interface {
+	// Build assembles the distributable packages and returns the
+	// names of the files they were written to.
+	Build(*Package) ([]string, error)
+}
+
 type Package struct {
 	// ProjectName is the name of the project as it should appear on
 	// the final package.
 	ProjectName string
 
-	// ProjectOwners is a list of owners of the project.
+	// ProjectOwners is a list of owners of the project. Those other
+	// than the Maintainer are listed as Uploaders of the Debian
+	// package, and all are the copyright holders of files whose
+	// owners are not given.
 	ProjectOwners []Person
 
 	// Maintainer is the person who maintains the package, and may be
@@ -39,6 +51,28 @@ type Package struct {
 	// Description is a brief, one line description of the project.
 	Description string
 
+	// Version is the upstream version of the project. If it is
+	// empty, it is found from the most recent version control tag,
+	// or a snapshot version is made if there are changes since it. It
+	// must be given if there is no version control, such as when
+	// building from a release tarball.
+	Version string `json:",omitempty"`
+
+	// Epoch is prepended to the version, if it is given, so that the
+	// package sorts as newer even if the versioning scheme changes.
+	Epoch int `json:",omitempty"`
+
+	// Revision is the revision of the package itself, such as "1."
+	// It should be incremented when the package changes but the
+	// upstream Version does not.
+	Revision string `json:",omitempty"`
+
+	// LongDescription is a longer description of the project, which
+	// may span several paragraphs separated by blank lines. Lines
+	// which begin with whitespace are displayed verbatim, and all
+	// others are wrapped.
+	LongDescription string
+
 	// Homepage is a link (HTTP or HTTPS) to the project homepage.
 	Homepage string
 
@@ -46,6 +80,15 @@ type Package struct {
 	// repository) of the startup script, if applicable.
 	InitScript string
 
+	// Services is a list of systemd units, such as services, sockets,
+	// and timers, which are installed with the package.
+	Services []*Service
+
+	// PreInst, PostInst, PreRm, and PostRm are the maintainer scripts
+	// which are run before and after the package is installed and
+	// removed, if applicable.
+	PreInst, PostInst, PreRm, PostRm *Script
+
 	// Install is a list of paths or globs (relative to the top of the
 	// package repository) and non-rooted target paths (such as
 	// "usr/bin") to which they will be moved upon package install.
@@ -65,18 +108,26 @@ type Package struct {
 	// types, such as GPL 3.0+.
 	Copyright *Copyright
 
-	// BuildDepends is a slice containing the package names (and
-	// versions) of any packages required to build this one.
-	BuildDepends []string
+	// BuildDepends is a slice containing the Relations to any
+	// packages required to build this one.
+	BuildDepends []Relation
 
-	// Depends is a slice containing the package names (and versions)
-	// of any packages required to run this one.
-	Depends []string
+	// Depends is a slice containing the Relations to any packages
+	// required to run this one.
+	Depends []Relation
 
 	// Recommends, Suggests, Conflicts, Provides, and Replaces are
-	// non-required slices containing package names (and versions) of
-	// any packages as indicated by the name.
-	Recommends, Suggests, Conflicts, Provides, Replaces []string
+	// non-required slices containing Relations to any packages as
+	// indicated by the name.
+	Recommends, Suggests, Conflicts, Provides, Replaces []Relation
+
+	// PackageNames map logical package names, such as
+	// "openssl-runtime," which may be used in any of the relations
+	// above, to the packages which satisfy them for each package type,
+	// such as "deb." They extend the built in names, and replace the
+	// built in entries for the same name and package type. A logical
+	// name which maps to several packages cannot be an alternative.
+	PackageNames map[string]map[string][]Relation `json:",omitempty"`
 
 	// Section is the section of the repository, if applicable, to
 	// mark the package as part of, such as "devel" for Debian.
@@ -91,22 +142,284 @@ type Package struct {
 	// interpreted language such as Python, it should be "all," and if
 	// it does not require a specific platform, it should be "any."
 	Architecture string
+
+	// Changelog controls how the changelog is made from the version
+	// control log.
+	Changelog *ChangelogOptions `json:",omitempty"`
+
+	// Build controls how the project is built. If it is not given,
+	// the build system is detected from the files in the project.
+	Build *BuildOptions `json:",omitempty"`
+
+	// DebhelperCompat is the debhelper compatibility level of the
+	// Debian package, which is given in Build-Depends as
+	// "debhelper-compat (= 13)." If it is zero, 13 is used.
+	DebhelperCompat int `json:",omitempty"`
+
+	// Packages is a list of binary packages built from the project,
+	// for projects which ship more than one, such as "foo" and
+	// "foo-dev." If it is empty, a single binary package is built
+	// from the ProjectName, Description, Architecture, dependency,
+	// Install, Docs, ManPages, and InitScript fields above.
+	Packages []*BinaryPackage `json:",omitempty"`
+}
+
+// A BinaryPackage is a single binary package built from the
+// project. Its fields have the same meanings as those of the same
+// names in Package.
+type BinaryPackage struct {
+	// Name is the name of the binary package.
+	Name string
+
+	// Description is a brief, one line description of the binary
+	// package.
+	Description string
+
+	// LongDescription is a longer description of the binary package,
+	// formatted as in Package.
+	LongDescription string `json:",omitempty"`
+
+	// Architecture is the processor architecture for which the
+	// binary package is built. If it is empty, the Architecture of
+	// the Package is used.
+	Architecture string `json:",omitempty"`
+
+	// Depends, Recommends, Suggests, Conflicts, Provides, and
+	// Replaces are slices containing Relations to any packages as
+	// indicated by the name.
+	Depends                                             []Relation
+	Recommends, Suggests, Conflicts, Provides, Replaces []Relation `json:",omitempty"`
+
+	// Install, Docs, ManPages, InitScript, and Services list the
+	// files which belong to this binary package.
+	Install, Docs, ManPages []string   `json:",omitempty"`
+	InitScript              string     `json:",omitempty"`
+	Services                []*Service `json:",omitempty"`
+
+	// PreInst, PostInst, PreRm, and PostRm are the maintainer scripts
+	// of this binary package.
+	PreInst, PostInst, PreRm, PostRm *Script `json:",omitempty"`
+}
+
+// ChangelogOptions control how the version control log is turned into
+// the changelog.
+type ChangelogOptions struct {
+	// Conventional parses commit messages as Conventional Commits,
+	// such as "fix(parser): handle empty files," and groups them into
+	// sections by type. Bugs named in "Closes: #123" trailers are
+	// noted as closed.
+	Conventional bool
+
+	// Ignore is the list of Conventional Commit types which are left
+	// out of the changelog. It defaults to "chore," "ci," and "docs."
+	Ignore []string `json:",omitempty"`
+}
+
+// BuildOptions control how the project is built in debian/rules, the
+// RPM spec file, and the PKGBUILD.
+type BuildOptions struct {
+	// System is the build system, if it should not be detected. It
+	// is one of "cmake," "meson," "autotools," "cargo," "python,"
+	// "make," or "go."
+	System string `json:",omitempty"`
+
+	// Build and Install are shell commands which replace those of the
+	// build system, run in order. Install commands should install the
+	// project into $DESTDIR.
+	Build, Install []string `json:",omitempty"`
+
+	// InferDepends adds the dependencies inferred from the project,
+	// such as the Go toolchain required by go.mod, to BuildDepends and
+	// Depends when the framework or package is made, as is done when
+	// creating a template sanepack file.
+	InferDepends bool `json:",omitempty"`
+
+	// Requirements extend the tables which map the requirements
+	// inferred from the project, such as "go," "cgo," or the name of
+	// a build system, to the packages which satisfy them. They are
+	// keyed by package type, such as "deb," and then by requirement,
+	// and replace the built in entries of the same names.
+	Requirements map[string]map[string]*requirementPackages `json:",omitempty"`
+
+	// Shlibs, if given, adds the packages providing the shared
+	// libraries which the installed ELF binaries need to Depends when
+	// the package is built by sanepack.
+	Shlibs *ShlibsOptions `json:",omitempty"`
+}
+
+// A Script is a maintainer script, given either as the path to a
+// script or as an inline snippet of shell.
+type Script struct {
+	// File is the path (relative to the top of the package
+	// repository) of the script.
+	File string `json:",omitempty"`
+
+	// Inline is a snippet of shell, which will be placed in a
+	// generated script.
+	Inline string `json:",omitempty"`
+}
+
+// A Service is a systemd unit, given either as the path to an
+// existing unit file or as a declarative description of a service.
+type Service struct {
+	// Name is the name of the unit, such as "foo.service" or
+	// "foo.socket." If it has no extension, it is assumed to be a
+	// service. If it is empty, the name of the unit File is used, or
+	// the name of the binary package, if there is no File.
+	Name string `json:",omitempty"`
+
+	// File is the path (relative to the top of the package
+	// repository) of an existing unit file.
+	File string `json:",omitempty"`
+
+	// Description, ExecStart, User, Restart, After, and WantedBy
+	// describe a service if no File is given. They are placed in the
+	// unit file under the same names. WantedBy defaults to
+	// "multi-user.target."
+	Description, ExecStart, User, Restart string   `json:",omitempty"`
+	After, WantedBy                       []string `json:",omitempty"`
+
+	// NoEnable prevents the unit from being enabled when the package
+	// is installed, and NoRestart prevents it from being restarted
+	// when the package is upgraded.
+	NoEnable, NoRestart bool `json:",omitempty"`
+}
+
+// Contents returns the contents of the script file, if one is given,
+// or the inline snippet otherwise.
+func (s *Script) Contents() (string, error) {
+	if len(s.File) == 0 {
+		return s.Inline, nil
+	}
+	b, err := ioutil.ReadFile(s.File)
+	return string(b), err
 }
 
+// A Person is someone who owns or maintains the project.
 type Person struct {
 	Name, Email string
+
+	// Role is the part the person plays in the project, such as
+	// "author" or "translator." Owners with the role "upstream" are
+	// not listed as Uploaders of the Debian package.
+	Role string `json:",omitempty"`
+
+	// Years are the years in which the person holds copyright, such
+	// as "2013-2015" or "2013, 2015."
+	Years string `json:",omitempty"`
+}
+
+// String returns the name and email of the person in the form
+// "Name <email>," or only the name if there is no email.
+func (p Person) String() string {
+	if len(p.Email) == 0 {
+		return p.Name
+	}
+	return p.Name + " <" + p.Email + ">"
+}
+
+// Is reports whether the two are the same person. People are the same
+// if they have the same email, or the same name if either has no
+// email.
+func (p Person) Is(other Person) bool {
+	if len(p.Email) > 0 && len(other.Email) > 0 {
+		return strings.EqualFold(p.Email, other.Email)
+	}
+	return p.Name == other.Name
 }
 
+// A Copyright gives the copyright and license of the project. Licenses
+// are SPDX license expressions, such as "MIT OR Apache-2.0," which are
+// translated to the conventions of each framework.
 type Copyright struct {
 	Name, License string
 	Homepage      string `json:",omitempty"`
 	Files         []*fileCopyright
+
+	// LicenseFile is the path (relative to the top of the package
+	// repository) of the full text of the License. If it is not
+	// given, the text is built in for common licenses, or is read
+	// from a file such as LICENSE or COPYING.
+	LicenseFile string `json:",omitempty"`
+
+	// FilesExcluded is a list of globs of files which are removed
+	// from the upstream source.
+	FilesExcluded []string `json:",omitempty"`
+
+	// Comment is any additional information about the copyright of
+	// the project.
+	Comment string `json:",omitempty"`
 }
 
+// A fileCopyright gives the owners and license of the files matching
+// Glob, which may be several globs separated by spaces. The owners are
+// the Owner and Owners, or the ProjectOwners if neither is given. Years
+// is used for owners who have no Years of their own, and Year if
+// neither is given. The License is an SPDX license expression, as in
+// the Copyright.
 type fileCopyright struct {
 	Glob, License string
 	Year          int
+	Years         string `json:",omitempty"`
 	Owner         Person
+	Owners        []Person `json:",omitempty"`
+	Comment       string   `json:",omitempty"`
+}
+
+// Binaries returns the binary packages built from the Package. If no
+// Packages are given, a single one is made from the top level fields.
+func (p *Package) Binaries() []*BinaryPackage {
+	if len(p.Packages) == 0 {
+		return []*BinaryPackage{{
+			Name:            p.ProjectName,
+			Description:     p.Description,
+			LongDescription: p.LongDescription,
+			Architecture:    p.Architecture,
+			Depends:         p.Depends,
+			Recommends:      p.Recommends,
+			Suggests:        p.Suggests,
+			Conflicts:       p.Conflicts,
+			Provides:        p.Provides,
+			Replaces:        p.Replaces,
+			Install:         p.Install,
+			Docs:            p.Docs,
+			ManPages:        p.ManPages,
+			InitScript:      p.InitScript,
+			Services:        p.Services,
+			PreInst:         p.PreInst,
+			PostInst:        p.PostInst,
+			PreRm:           p.PreRm,
+			PostRm:          p.PostRm,
+		}}
+	}
+
+	binaries := make([]*BinaryPackage, len(p.Packages))
+	for i, b := range p.Packages {
+		// Copy each binary package so that the Architecture can be
+		// inherited without modifying the Package.
+		binary := *b
+		if len(binary.Architecture) == 0 {
+			binary.Architecture = p.Architecture
+		}
+		binaries[i] = &binary
+	}
+	return binaries
+}
+
+// These placeholders are used by templatePackage where no sensible
+// default can be found, and must be replaced by the user.
+const (
+	placeholderLicense      = "SPDX license expression (such as GPL-3.0-or-later)"
+	placeholderManPage      = "path/to/manpage.1"
+	placeholderBuildDepends = "package for your compiler here"
+	placeholderDepends      = "package(s) required to run this package"
+)
+
+// templatePlaceholders is the list of all placeholders, which are
+// reported by lint if they are left in a Package.
+var templatePlaceholders = []string{
+	placeholderLicense, placeholderManPage,
+	placeholderBuildDepends, placeholderDepends,
 }
 
 // templatePackage attempts to use the current working directory to
@@ -122,26 +435,14 @@ func templatePackage() (p *Package) {
 	} else { // If this fails, it will be left blank.
 		l.Debugf("Could not get ProjectName: %s", err)
 	}
-	// Now, try to find the current user's name using git
-	// defaults. This will be used to initialize ProjectOwners and
-	// Maintainer.
-	// TODO: allow use of other systems than git
-	var user Person
-	if vcsName, err := exec.Command("git", "config", "--global",
-		"user.name").Output(); err == nil { // Again, err == nil
-		user.Name = string(vcsName[:len(vcsName)-1]) // -1 to remove \n
-		l.Debugf("Found current user name: %q\n", user.Name)
-	} else {
-		l.Debugf("Could not get current user name: %q", err)
-	}
-
-	// Same as above, but for email.
-	if vcsEmail, err := exec.Command("git", "config", "--global",
-		"user.email").Output(); err == nil {
-		user.Email = string(vcsEmail[:len(vcsEmail)-1]) // as above
-		l.Debugf("Found current user email: %q\n", user.Email)
+	// Now, try to find the current user's name and email from the
+	// version control configuration. This will be used to initialize
+	// ProjectOwners and Maintainer.
+	user, err := vcsUser()
+	if err == nil {
+		l.Debugf("Found current user: %q <%s>\n", user.Name, user.Email)
 	} else {
-		l.Debugf("Could not get current user email: %s", err)
+		l.Debugf("Could not get current user: %s\n", err)
 	}
 
 	// Whether user could be initialized or not, we'll use it to fill
@@ -152,29 +453,37 @@ func templatePackage() (p *Package) {
 	// Set up Install, Docs, and ManPages with initialized slices.
 	p.Install = []string{p.ProjectName + " usr/bin"}
 	p.Docs = []string{"README"}
-	p.ManPages = []string{"path/to/manpage.1"}
+	p.ManPages = []string{placeholderManPage}
 
 	// Try to initialize Copyright with sane defaults.
 	p.Copyright = &Copyright{
 		Name:     p.ProjectName,
-		License:  "abbreviated license name (such as GPL-3+)",
+		License:  placeholderLicense,
 		Homepage: p.Homepage,
 		Files:    make([]*fileCopyright, 1),
 	}
 	year, _, _ := time.Now().Date()
 	p.Copyright.Files[0] = &fileCopyright{
 		Glob:    "*",
-		License: "GPL-3+",
+		License: "GPL-3.0-or-later",
 		Year:    year,
 		Owner:   user,
 	}
 
-	// Set up BuildDepends and Depends with initialized slices.
-	p.BuildDepends = make([]string, 1)
-	p.BuildDepends[0] = "package for your compiler here"
-
-	p.Depends = make([]string, 1)
-	p.Depends[0] = "package(s) required to run this package"
+	// Infer BuildDepends and Depends from the project for the
+	// package type given by -t. If nothing can be inferred, they are
+	// left as placeholders. If only build dependencies are found, as
+	// for a Go command, it may need nothing at runtime, so Depends is
+	// left empty rather than nil.
+	p.BuildDepends, p.Depends = inferDepends(p, *fType)
+	if len(p.BuildDepends) == 0 {
+		p.BuildDepends = []Relation{{Name: placeholderBuildDepends}}
+		if len(p.Depends) == 0 {
+			p.Depends = []Relation{{Name: placeholderDepends}}
+		}
+	} else if p.Depends == nil {
+		p.Depends = []Relation{}
+	}
 
 	// Here, we assume that the section is "main." This may be
 	// incorrect, but it will serve as a template.
@@ -189,3 +498,12 @@ func templatePackage() (p *Package) {
 
 	return
 }
+
+// UpstreamVersion returns the Version of the Package, if it is given,
+// and otherwise finds it using version control.
+func (p *Package) UpstreamVersion() (string, error) {
+	if len(p.Version) > 0 {
+		return p.Version, nil
+	}
+	return vcsVersion()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// A Relation is a relation to another package, such as a dependency.
+// It may be given in a sanepack file either as a string in the syntax
+// of a Debian control file, such as "libc6 (>= 2.34) [linux-any] |
+// libc6.1," or as an object with the fields below. Either way, it is
+// written as a string.
+type Relation struct {
+	// Name is the name of the package, which may be qualified with an
+	// architecture, as in "python3:any."
+	Name string
+
+	// Op and Version restrict the relation to certain versions of the
+	// package. Op is one of "<<," "<=," "=," ">=," or ">>."
+	Op      string `json:",omitempty"`
+	Version string `json:",omitempty"`
+
+	// Arch restricts the relation to the given architectures, or, if
+	// they begin with "!," to all others, as in "[!hurd-any]." It
+	// only applies to build dependencies.
+	Arch []string `json:",omitempty"`
+
+	// Profiles restricts the relation to builds with certain build
+	// profiles. The relation applies if any of the formulas is
+	// satisfied, and each is satisfied if all of its profiles are
+	// active, or inactive if they begin with "!," as in "<!nocheck>."
+	// It only applies to build dependencies.
+	Profiles [][]string `json:",omitempty"`
+
+	// Alternatives are other packages, any of which will satisfy the
+	// relation in place of this one.
+	Alternatives []Relation `json:",omitempty"`
+}
+
+// relationOperators are the operators which may restrict the version
+// of a relation.
+var relationOperators = []string{"<<", "<=", "=", ">=", ">>"}
+
+// parseRelation parses a relation in the syntax of a Debian control
+// file. Alternatives are separated by "|."
+func parseRelation(s string) (r Relation, err error) {
+	for i, alternative := range strings.Split(s, "|") {
+		a, err := parseAlternative(alternative)
+		if err != nil {
+			return r, err
+		}
+		if i == 0 {
+			r = a
+		} else {
+			r.Alternatives = append(r.Alternatives, a)
+		}
+	}
+	return
+}
+
+// parseAlternative parses a single alternative of a relation, which is
+// a package name followed by an optional version restriction in
+// parentheses, architecture restriction in brackets, and any number of
+// build profile formulas in angle brackets.
+func parseAlternative(s string) (r Relation, err error) {
+	rest := strings.TrimSpace(s)
+	end := strings.IndexAny(rest, " \t([<")
+	if end < 0 {
+		end = len(rest)
+	}
+	r.Name, rest = rest[:end], strings.TrimSpace(rest[end:])
+	if len(r.Name) == 0 {
+		return r, errors.New("missing package name in relation " +
+			strings.TrimSpace(s))
+	}
+
+	// enclosed returns the contents of the part of rest between open
+	// and close, if rest begins with open.
+	enclosed := func(open, close string) (contents string, ok bool) {
+		if !strings.HasPrefix(rest, open) {
+			return "", false
+		}
+		i := strings.Index(rest, close)
+		if i < 0 {
+			err = errors.New("missing " + close + " in relation " +
+				strings.TrimSpace(s))
+			return "", false
+		}
+		contents, rest = rest[len(open):i], strings.TrimSpace(rest[i+1:])
+		return contents, true
+	}
+
+	if restriction, ok := enclosed("(", ")"); ok {
+		version := strings.TrimLeft(strings.TrimSpace(restriction), "<>=")
+		r.Op = strings.TrimSpace(strings.TrimSuffix(
+			strings.TrimSpace(restriction), version))
+		r.Version = strings.TrimSpace(version)
+		if !contains(relationOperators, r.Op) {
+			return r, errors.New("invalid operator \"" + r.Op +
+				"\" in relation " + strings.TrimSpace(s))
+		}
+	}
+	if arches, ok := enclosed("[", "]"); ok {
+		r.Arch = strings.Fields(arches)
+	}
+	for {
+		formula, ok := enclosed("<", ">")
+		if !ok {
+			break
+		}
+		r.Profiles = append(r.Profiles, strings.Fields(formula))
+	}
+	if err == nil && len(rest) > 0 {
+		err = errors.New("unexpected " + rest + " in relation " +
+			strings.TrimSpace(s))
+	}
+	return
+}
+
+// parseRelations parses a list of relations separated by commas, as in
+// a field of a Debian control file. Empty entries, such as those left
+// by a trailing comma, are skipped.
+func parseRelations(s string) (relations []Relation, err error) {
+	for _, field := range strings.Split(s, ",") {
+		if len(strings.TrimSpace(field)) == 0 {
+			continue
+		}
+		r, err := parseRelation(field)
+		if err != nil {
+			return nil, err
+		}
+		relations = append(relations, r)
+	}
+	return
+}
+
+// mustParseRelations parses relations which are known to be valid,
+// such as those built into sanepack.
+func mustParseRelations(relations ...string) (parsed []Relation) {
+	for _, s := range relations {
+		r, err := parseRelation(s)
+		if err != nil {
+			panic(err)
+		}
+		parsed = append(parsed, r)
+	}
+	return
+}
+
+// String returns the relation in the syntax of a Debian control file.
+func (r Relation) String() string {
+	s := r.Name
+	if len(r.Op) > 0 || len(r.Version) > 0 {
+		s += " (" + r.Op + " " + r.Version + ")"
+	}
+	if len(r.Arch) > 0 {
+		s += " [" + concat(" ", r.Arch...) + "]"
+	}
+	for _, formula := range r.Profiles {
+		s += " <" + concat(" ", formula...) + ">"
+	}
+	for _, a := range r.Alternatives {
+		s += " | " + a.String()
+	}
+	return s
+}
+
+// Choices returns the relation and each of its alternatives, each
+// without any further alternatives.
+func (r Relation) Choices() (choices []Relation) {
+	first := r
+	first.Alternatives = nil
+	choices = append(choices, first)
+	for _, a := range r.Alternatives {
+		choices = append(choices, a.Choices()...)
+	}
+	return
+}
+
+// Package returns the Name without any architecture qualifier.
+func (r Relation) Package() string {
+	return strings.SplitN(r.Name, ":", 2)[0]
+}
+
+// MarshalText writes the relation as a string, so that sanepack files
+// are written in the same syntax in every format.
+func (r Relation) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON reads a relation given either as a string or as an
+// object. Placeholders left from templatePackage are kept as the Name,
+// so that they can be reported by lint.
+func (r *Relation) UnmarshalJSON(data []byte) (err error) {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		if isPlaceholder(s) {
+			*r = Relation{Name: s}
+			return nil
+		}
+		*r, err = parseRelation(s)
+		return
+	}
+
+	// The fields are decoded into a type without this method, so that
+	// it is not called again.
+	type plainRelation Relation
+	var plain plainRelation
+	err = json.Unmarshal(data, &plain)
+	if err != nil {
+		return
+	}
+	if len(plain.Name) == 0 {
+		return errors.New("missing Name in relation " + string(data))
+	}
+	*r = Relation(plain)
+	return
+}
+
+// UnmarshalTOML reads a relation given either as a string or as a
+// table, by way of JSON.
+func (r *Relation) UnmarshalTOML(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.UnmarshalJSON(data)
+}
+
+// debianRelations joins the relations as in a Debian control file.
+func debianRelations(relations []Relation) string {
+	s := make([]string, len(relations))
+	for i, r := range relations {
+		s[i] = r.String()
+	}
+	return concat(", ", s...)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseRelation(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Relation
+	}{
+		{"libc6", Relation{Name: "libc6"}},
+		{" libc6 ", Relation{Name: "libc6"}},
+		{"python3:any", Relation{Name: "python3:any"}},
+		{"libc6 (>= 2.34)", Relation{Name: "libc6", Op: ">=", Version: "2.34"}},
+		{"libc6(>=2.34)", Relation{Name: "libc6", Op: ">=", Version: "2.34"}},
+		{"foo (<< 2:1.0~rc1-1)", Relation{Name: "foo", Op: "<<", Version: "2:1.0~rc1-1"}},
+		{"foo (= 1.0)", Relation{Name: "foo", Op: "=", Version: "1.0"}},
+		{"foo [linux-any !hurd-any]", Relation{Name: "foo", Arch: []string{"linux-any", "!hurd-any"}}},
+		{
+			"foo <!nocheck> <stage1 cross>",
+			Relation{Name: "foo", Profiles: [][]string{{"!nocheck"}, {"stage1", "cross"}}},
+		},
+		{
+			"foo (>= 1.0) [amd64] <!nocheck>",
+			Relation{Name: "foo", Op: ">=", Version: "1.0", Arch: []string{"amd64"},
+				Profiles: [][]string{{"!nocheck"}}},
+		},
+		{
+			"libc6 (>= 2.34) | libc6.1",
+			Relation{Name: "libc6", Op: ">=", Version: "2.34",
+				Alternatives: []Relation{{Name: "libc6.1"}}},
+		},
+	}
+	for _, test := range tests {
+		r, err := parseRelation(test.in)
+		if err != nil {
+			t.Errorf("parseRelation(%q): %s", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(r, test.want) {
+			t.Errorf("parseRelation(%q) = %#v, want %#v", test.in, r, test.want)
+		}
+	}
+}
+
+func TestParseRelationInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"| foo",
+		"foo |",
+		"foo (>= 1.0",
+		"foo [amd64",
+		"foo <!nocheck",
+		"foo (1.0)",
+		"foo (> 1.0)",
+		"foo (< 1.0)",
+		"foo (=> 1.0)",
+		"foo (>>= 1.0)",
+		"foo bar",
+		"foo (>= 1.0) baz",
+	} {
+		if r, err := parseRelation(in); err == nil {
+			t.Errorf("parseRelation(%q) = %#v, want error", in, r)
+		}
+	}
+}
+
+func TestParseRelations(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"libfoo1 (>= 1.0), libbar2", []string{"libfoo1 (>= 1.0)", "libbar2"}},
+		{"a | b, c,", []string{"a | b", "c"}},
+	}
+	for _, test := range tests {
+		relations, err := parseRelations(test.in)
+		if err != nil {
+			t.Errorf("parseRelations(%q): %s", test.in, err)
+			continue
+		}
+		var got []string
+		for _, r := range relations {
+			got = append(got, r.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseRelations(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestRelationString(t *testing.T) {
+	// Relations in the canonical form are written as they were read.
+	for _, s := range []string{
+		"libc6",
+		"libc6 (>= 2.34)",
+		"foo [linux-any] <!nocheck>",
+		"foo (>= 1.0) [amd64] <!nocheck> <stage1 cross> | bar | baz (<< 2)",
+	} {
+		r, err := parseRelation(s)
+		if err != nil {
+			t.Errorf("parseRelation(%q): %s", s, err)
+			continue
+		}
+		if r.String() != s {
+			t.Errorf("parseRelation(%q).String() = %q", s, r.String())
+		}
+	}
+}
+
+func TestRelationUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Relation
+	}{
+		{`"libc6 (>= 2.34)"`, Relation{Name: "libc6", Op: ">=", Version: "2.34"}},
+		{
+			`{"Name": "libc6", "Op": ">=", "Version": "2.34", "Alternatives": ["libc6.1"]}`,
+			Relation{Name: "libc6", Op: ">=", Version: "2.34",
+				Alternatives: []Relation{{Name: "libc6.1"}}},
+		},
+	}
+	for _, test := range tests {
+		var r Relation
+		err := json.Unmarshal([]byte(test.in), &r)
+		if err != nil {
+			t.Errorf("Unmarshal(%s): %s", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(r, test.want) {
+			t.Errorf("Unmarshal(%s) = %#v, want %#v", test.in, r, test.want)
+		}
+	}
+
+	for _, in := range []string{`"foo (~ 1)"`, `{"Op": ">="}`, `12`} {
+		var r Relation
+		if err := json.Unmarshal([]byte(in), &r); err == nil {
+			t.Errorf("Unmarshal(%s) = %#v, want error", in, r)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type RpmFrameworker struct {
+	t    *template.Template
+	g    *generator
+	spec string
+}
+
+const (
+	RpmInfo = `To complete building the package, place a source tarball named
+<name>-<version>.tar.gz in your rpmbuild SOURCES directory and invoke:
+    rpmbuild -ba `
+
+	rpmRelease = "1"
+
+	// rpmFileList is the file in which %install lists the files
+	// installed by the build system, for use with %files -f.
+	rpmFileList = "%{name}.files"
+)
+
+// rpmArchitectures maps Debian architecture names, which are used in
+// the Package, to their RPM equivalents.
+var rpmArchitectures = map[string]string{
+	"amd64":   "x86_64",
+	"i386":    "i686",
+	"armhf":   "armv7hl",
+	"arm64":   "aarch64",
+	"ppc64el": "ppc64le",
+	"s390x":   "s390x",
+}
+
+func (r *RpmFrameworker) Info() string {
+	return RpmInfo + r.spec
+}
+
+func (r *RpmFrameworker) Framework(p *Package) (err error) {
+	// Begin by trying to load the templates.
+	r.t, err = loadTemplates("rpm", "systemd")
+	if err != nil {
+		return
+	}
+	l.Debug("Loaded rpm/*.template files")
+
+	p = p.resolveNames("rpm")
+	r.g = newGenerator("rpm")
+	r.spec = p.ProjectName + ".spec"
+	l.Debugf("Creating %s\n", r.spec)
+	err = r.specfile(p)
+	if err != nil {
+		return
+	}
+	return r.g.Commit()
+}
+
+// specfile creates a "<name>.spec" file from the given Package, and
+// reads the version control changelog in order to populate the
+// %changelog section, with one entry for each release.
+func (r *RpmFrameworker) specfile(p *Package) (err error) {
+	// First, check that all required fields are given.
+	if len(p.ProjectName) == 0 || len(p.Description) == 0 ||
+		p.Copyright == nil || len(p.Copyright.License) == 0 ||
+		len(p.Maintainer.Name) == 0 || len(p.Maintainer.Email) == 0 {
+		return errors.New("rpm: not all required fields are given; " +
+			"run 'sanepack lint' for details")
+	}
+
+	// Read the version in the same way as the debian changelog. As in
+	// Arch, the version may not contain hyphens, and the Revision is
+	// given as the Release.
+	ctx, err := newTemplateContext(p)
+	if err != nil {
+		return
+	}
+
+	// Fedora and openSUSE give licenses as SPDX expressions, so the
+	// License is used in its canonical form.
+	license, err := parseLicense(p.Copyright.License)
+	if err != nil {
+		return fmt.Errorf("rpm: invalid license %q: %s",
+			p.Copyright.License, err)
+	}
+
+	spec := &rpmSpecFile{
+		templateContext: ctx,
+		Name:            p.ProjectName,
+		Version:         strings.Replace(ctx.UpstreamVersion, "-", ".", -1),
+		Epoch:           p.Epoch,
+		Release:         rpmRelease,
+		Summary:         rpmEscape(p.Description),
+		Description:     rpmDescription(p.Description, p.LongDescription),
+		License:         license.String(),
+		URL:             p.Homepage,
+		BuildRequires:   rpmRelations(p.BuildDepends),
+		Include:         make(map[string]bool, 2),
+	}
+
+	// "all" packages are architecture independent, "any" packages
+	// may be built anywhere, and anything else restricts the
+	// architectures the package may be built on.
+	switch p.Architecture {
+	case "all":
+		spec.BuildArch = "noarch"
+	case "any", "":
+	default:
+		arch, ok := rpmArchitectures[p.Architecture]
+		if !ok {
+			arch = p.Architecture
+		}
+		spec.ExclusiveArch = arch
+	}
+
+	if len(p.Revision) != 0 {
+		spec.Release = p.Revision
+	}
+	if len(p.Homepage) != 0 {
+		spec.Include["URL"] = true
+	}
+
+	spec.Build, spec.InstallCommands, err = rpmBuildCommands(p)
+	if err != nil {
+		return
+	}
+	spec.Changelog, err = rpmChangelog(p, spec)
+	if err != nil {
+		return
+	}
+
+	// The binary package with the same name as the project is the
+	// main package, and any others are subpackages.
+	for _, b := range p.Binaries() {
+		sub, err := r.subpackage(spec, b)
+		if err != nil {
+			return err
+		}
+		if b.Name == p.ProjectName {
+			spec.Main = sub
+		} else {
+			sub.Suffix = " -n " + b.Name
+			spec.Subpackages = append(spec.Subpackages, sub)
+		}
+	}
+
+	// The files installed by the build system are listed as they are
+	// found in %install, and belong to the main package, or to the
+	// first subpackage if there is none.
+	if len(spec.InstallCommands) > 0 {
+		spec.FileList = rpmFileList
+		if spec.Main != nil {
+			spec.Main.FileList = spec.FileList
+		} else {
+			spec.Subpackages[0].FileList = spec.FileList
+		}
+	}
+
+	// The systemd scriptlet macros must be available if there are any
+	// systemd units.
+	if len(spec.Units) > 0 {
+		spec.BuildRequires = append(spec.BuildRequires, "systemd-rpm-macros")
+	}
+
+	// Attempt to open the spec file.
+	f, err := r.g.Create(r.spec)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	return r.t.ExecuteTemplate(f, "spec.template", spec)
+}
+
+// rpmBuildCommands returns the commands which build the project in
+// %build and install it into the buildroot in %install, using the
+// macros of the build system, as debian/rules does with debhelper.
+// The Build and Install commands of the BuildOptions replace them.
+func rpmBuildCommands(p *Package) (build, install []string, err error) {
+	bs, err := findBuildSystem(p)
+	if err != nil {
+		return nil, nil, fmt.Errorf("rpm: %s", err)
+	}
+	if bs != nil {
+		switch bs.Name {
+		case "cmake":
+			build = []string{"%cmake", "%cmake_build"}
+			install = []string{"%cmake_install"}
+		case "meson":
+			build = []string{"%meson", "%meson_build"}
+			install = []string{"%meson_install"}
+		case "autotools":
+			if _, err := os.Stat("configure"); err != nil {
+				build = append(build, "autoreconf -fi")
+			}
+			build = append(build, "%configure", "%make_build")
+			install = []string{"%make_install"}
+		case "cargo":
+			build = []string{"cargo build --release"}
+		case "python":
+			build = []string{"%py3_build"}
+			install = []string{"%py3_install"}
+		case "make":
+			// Not every Makefile has an install target.
+			build = []string{"%make_build"}
+			install = []string{"if make -n install >/dev/null 2>&1; " +
+				"then %make_install; fi"}
+		case "go":
+			// The version is set in the same way as in debian/rules.
+			command, version := goCommand()
+			gobuild := "go build -trimpath"
+			if version {
+				gobuild += ` -ldflags "-X main.Version=%{version}"`
+			}
+			if command {
+				gobuild += " -o " + p.ProjectName + " ."
+			} else {
+				gobuild += " -o ./ ./..."
+			}
+			build = []string{"export GOCACHE=$PWD/.gocache", gobuild}
+		}
+	}
+
+	if p.Build != nil {
+		if len(p.Build.Build) > 0 {
+			build = p.Build.Build
+		}
+		if len(p.Build.Install) > 0 {
+			install = append([]string{"export DESTDIR=%{buildroot}"},
+				p.Build.Install...)
+		}
+	}
+	return
+}
+
+// rpmChangelog creates the entries of %changelog in the same way as
+// debian/changelog, with one for each release, newest first, and one
+// for the current version if it has not been released.
+func rpmChangelog(p *Package, spec *rpmSpecFile) (entries []*rpmChangelogEntry, err error) {
+	releases, err := vcsReleases()
+	if err != nil {
+		return
+	}
+
+	if len(releases) == 0 || releases[0].Version != spec.UpstreamVersion {
+		var since string
+		if len(releases) > 0 {
+			since = releases[0].Tag
+		}
+		sections, err := changelogSections(p, since, "")
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, newRpmChangelogEntry(p,
+			spec.Version+"-"+spec.Release, spec.Date, p.Maintainer, sections))
+	}
+
+	for _, release := range releases {
+		author := release.Author
+		if len(author.Name) == 0 || len(author.Email) == 0 {
+			author = p.Maintainer
+		}
+		sections, err := changelogSections(p, release.Since, release.Tag)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, newRpmChangelogEntry(p,
+			strings.Replace(release.Version, "-", ".", -1)+"-"+rpmRelease,
+			release.Date, author, sections))
+	}
+	return
+}
+
+// newRpmChangelogEntry creates a single %changelog entry for the given
+// version and release, with its changes escaped. As in
+// debian/changelog, if there were no commits, the release itself is
+// listed.
+func newRpmChangelogEntry(p *Package, version string, date time.Time, maintainer Person, sections []*changelogSection) *rpmChangelogEntry {
+	if p.Epoch > 0 {
+		version = strconv.Itoa(p.Epoch) + ":" + version
+	}
+	entry := &rpmChangelogEntry{
+		Version:    version,
+		Date:       date.Format("Mon Jan 02 2006"),
+		Maintainer: maintainer,
+	}
+	if len(sections) == 0 {
+		sections = []*changelogSection{{Changes: []string{"Release " + version}}}
+	}
+	for _, section := range sections {
+		escaped := &changelogSection{Title: section.Title}
+		for _, change := range section.Changes {
+			escaped.Changes = append(escaped.Changes, rpmEscape(change))
+		}
+		entry.Sections = append(entry.Sections, escaped)
+	}
+	return entry
+}
+
+// subpackage creates an rpmSubpackage for the given binary package,
+// and adds the commands necessary to install its files to the spec.
+func (r *RpmFrameworker) subpackage(spec *rpmSpecFile, b *BinaryPackage) (sub *rpmSubpackage, err error) {
+	sub = &rpmSubpackage{
+		Name:        b.Name,
+		Summary:     rpmEscape(b.Description),
+		Description: rpmDescription(b.Description, b.LongDescription),
+		Requires:    rpmRelations(b.Depends),
+		Recommends:  rpmRelations(b.Recommends),
+		Suggests:    rpmRelations(b.Suggests),
+		Conflicts:   rpmRelations(b.Conflicts),
+		Provides:    rpmRelations(b.Provides),
+		Obsoletes:   rpmRelations(b.Replaces),
+		Docs:        b.Docs,
+	}
+
+	// Architecture independent subpackages of architecture dependent
+	// packages must be marked as such.
+	if b.Architecture == "all" && len(spec.BuildArch) == 0 {
+		sub.BuildArch = "noarch"
+	}
+
+	// Each Install line is a source path or glob and a target
+	// directory. The target directory is created and the sources
+	// copied into it in %install, and each resulting file is listed
+	// in %files.
+	for _, line := range b.Install {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			l.Debugf("Skipping malformed install line %q\n", line)
+			continue
+		}
+		src, dir := fields[0], "/"+strings.Trim(fields[1], "/")
+		spec.Install = append(spec.Install, rpmInstall{src, dir})
+
+		// Expand the glob so that the files can be listed
+		// individually. If it doesn't match anything yet, as may be
+		// the case before building, list the pattern itself.
+		matches, _ := filepath.Glob(src)
+		if len(matches) == 0 {
+			matches = []string{src}
+		}
+		for _, match := range matches {
+			sub.Files = append(sub.Files, path.Join(dir, path.Base(match)))
+		}
+	}
+
+	// Manpages are installed into the section directory matching
+	// their extension, and rpmbuild will compress them.
+	for _, page := range b.ManPages {
+		target := path.Join("%{_mandir}",
+			"man"+strings.TrimPrefix(path.Ext(page), "."), path.Base(page))
+		spec.ManPages = append(spec.ManPages, rpmInstall{page, target})
+		sub.Files = append(sub.Files, target+"*")
+	}
+
+	if len(b.InitScript) > 0 {
+		target := "%{_initrddir}/" + b.Name
+		spec.InitScripts = append(spec.InitScripts,
+			rpmInstall{b.InitScript, target})
+		sub.Files = append(sub.Files, target)
+	}
+
+	// systemd units are installed from their files, if given, or
+	// otherwise written out in %install, and are enabled, started,
+	// and stopped by the systemd scriptlet macros.
+	var units, restart, norestart []string
+	for _, s := range b.Services {
+		unit := rpmUnit{Target: s.Unit(b.Name), Source: s.File}
+		if len(s.File) == 0 {
+			contents, err := s.Contents(r.t, spec.templateContext)
+			if err != nil {
+				return nil, err
+			}
+			unit.Contents = rpmEscape(contents)
+		}
+		spec.Units = append(spec.Units, unit)
+		sub.Files = append(sub.Files, "%{_unitdir}/"+unit.Target)
+
+		units = append(units, unit.Target)
+		if s.NoRestart {
+			norestart = append(norestart, unit.Target)
+		} else {
+			restart = append(restart, unit.Target)
+		}
+	}
+	sub.Units = concat(" ", units...)
+	sub.RestartUnits = concat(" ", restart...)
+	sub.NoRestartUnits = concat(" ", norestart...)
+	return
+}
+
+// rpmRelations converts a slice of Relations to their RPM
+// equivalents, such that "libc6 (>= 2.3)" becomes "libc6 >= 2.3", and
+// alternatives such as "a | b" become "(a or b)". RPM has no
+// architecture qualifiers, so they are removed. Architecture and build
+// profile restrictions cannot be expressed, so they are dropped and
+// the relation always applies.
+func rpmRelations(relations []Relation) (converted []string) {
+	for _, relation := range relations {
+		var alternatives []string
+		for _, choice := range relation.Choices() {
+			alternatives = append(alternatives,
+				rpmRelation(choice.Package(), choice.Op, choice.Version))
+		}
+		if len(alternatives) > 1 {
+			// Alternatives are expressed as boolean dependencies.
+			converted = append(converted,
+				"("+concat(" or ", alternatives...)+")")
+		} else {
+			converted = append(converted, alternatives[0])
+		}
+	}
+	return
+}
+
+// rpmRelation formats a single relation, converting the strict
+// operators "<<" and ">>" to "<" and ">".
+func rpmRelation(name, op, version string) string {
+	switch op {
+	case "":
+		return name
+	case ">>":
+		op = ">"
+	case "<<":
+		op = "<"
+	}
+	return name + " " + op + " " + version
+}
+
+// rpmDescription formats the long description for use in a
+// %description section, wrapped at 80 columns. If there is no long
+// description, the short one is used instead.
+func rpmDescription(short, long string) string {
+	if len(strings.TrimSpace(long)) == 0 {
+		return rpmEscape(short)
+	}
+	return rpmEscape(concat("\n", wrap(long, 80)...))
+}
+
+// rpmEscape escapes the given string such that it will not be
+// interpreted as a macro by rpmbuild.
+func rpmEscape(s string) string {
+	return strings.Replace(s, "%", "%%", -1)
+}
+
+type rpmInstall struct {
+	Source, Target string
+}
+
+type rpmUnit struct {
+	Source, Target, Contents string
+}
+
+type rpmSpecFile struct {
+	templateContext
+	Name, Version, Release, Summary, License, URL string
+	Description, BuildArch, ExclusiveArch         string
+	FileList                                      string
+	Epoch                                         int
+	BuildRequires, Build, InstallCommands         []string
+	Changelog                                     []*rpmChangelogEntry
+	Main                                          *rpmSubpackage
+	Subpackages                                   []*rpmSubpackage
+	Install, ManPages, InitScripts                []rpmInstall
+	Units                                         []rpmUnit
+	Include                                       map[string]bool
+}
+
+type rpmChangelogEntry struct {
+	Version, Date string
+	Maintainer    Person
+	Sections      []*changelogSection
+}
+
+type rpmSubpackage struct {
+	Name, Summary, Description, BuildArch, Suffix string
+	Requires, Recommends, Suggests, Conflicts     []string
+	Provides, Obsoletes                           []string
+	Docs, Files                                   []string
+	Units, RestartUnits, NoRestartUnits, FileList string
+}
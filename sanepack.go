@@ -1,10 +1,11 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
 	"flag"
 	"github.com/inhies/go-utils/log"
 	"os"
+	"strings"
 )
 
 var (
@@ -14,18 +15,14 @@ var (
 	loglevel log.LogLevel = log.WARNING // Normally only show warnings
 )
 
-const (
-	defaultTemplates = "/usr/share/sanepack"
-)
-
 var (
 	fVersion = flag.Bool("version", false, "print version and exit")
 
-	fFile   = flag.String("f", "sanepack.json", "sanepack file to read")
+	fFile   = flag.String("f", "sanepack.json", "sanepack file to read (.json, .yaml, or .toml)")
 	fCreate = flag.Bool("c", false, "create a template sanepack file")
 
-	fType = flag.String("t", "deb", "package type (such as \"deb\")")
-	fTemp = flag.String("temp", defaultTemplates, "template location")
+	fType = flag.String("t", "deb", "package type (\"deb\", \"rpm\", or \"arch\")")
+	fTemp = flag.String("temp", "", "directory of templates which override the built in ones")
 
 	fQuiet = flag.Bool("q", false, "disable logging") // not implemented
 	fVerb  = flag.Bool("v", false, "enable verbose log output")
@@ -66,17 +63,62 @@ func main() {
 		return
 	}
 
+	// The "templates" command writes out the built in templates so
+	// that they can be customized, and does not need a sanepack file.
+	if flag.Arg(0) == "templates" {
+		dir := flag.Arg(1)
+		if len(dir) == 0 {
+			dir = *fTemp
+		}
+		if len(dir) == 0 {
+			dir = "templates"
+		}
+		l.Debugf("Trying to write templates to %q\n", dir)
+		written, err := dumpTemplates(dir)
+		if err != nil {
+			l.Fatalf("Failed to write templates: %s", err)
+		}
+		for _, filename := range written {
+			l.Println("Wrote " + filename)
+		}
+		return
+	}
+
 	// If we aren't creating a template, begin normal operation. Start
-	// by determining the package type.
+	// by determining the command and the package type. With no
+	// command, the framework is created. With "build", the
+	// distributable package is built directly, and with "lint", the
+	// sanepack file is only checked for problems.
 	var fw Frameworker
-	switch *fType {
-	case "deb":
-		fw = DebianFrameworker{}
+	var b Builder
+	var lint bool
+	switch flag.Arg(0) {
+	case "":
+		switch *fType {
+		case "deb":
+			fw = DebianFrameworker{}
+		case "rpm":
+			fw = new(RpmFrameworker)
+		case "arch":
+			fw = ArchFrameworker{}
+		default:
+			// If the type of package requested is invalid, exit.
+			l.Fatalf("Invalid package type: %q\n", *fType)
+		}
+		l.Debugf("Framework type: %q", *fType)
+	case "build":
+		switch *fType {
+		case "deb":
+			b = DebianBuilder{}
+		default:
+			l.Fatalf("Cannot build package type: %q\n", *fType)
+		}
+		l.Debugf("Builder type: %q", *fType)
+	case "lint":
+		lint = true
 	default:
-		// If the type of package requested is invalid, exit.
-		l.Fatalf("Invalid package type: %q\n", *fType)
+		l.Fatalf("Invalid command: %q\n", flag.Arg(0))
 	}
-	l.Debugf("Framework type: %q", *fType)
 
 	// Now continue on to try to open the file.
 	l.Debugf("Trying to open file: %q\n", *fFile)
@@ -91,8 +133,7 @@ func main() {
 
 	// Now that the file has been opened and can be read from, try to
 	// decode it into a Package.
-	p := new(Package)
-	err = json.NewDecoder(f).Decode(p)
+	p, err := decodePackage(*fFile, f)
 	f.Close() // Close the file the moment we're done with it.
 	if err != nil {
 		// If the decode fails, report it. As before, use l.Fatalf().
@@ -100,8 +141,53 @@ func main() {
 	}
 	l.Debug("Decode successful and file closed\n")
 
-	// Now, move on to creating the framework with the previously
-	// selected type.
+	// If linting, report every problem and fail if any are errors.
+	if lint {
+		l.Debugf("Linting %q\n", *fFile)
+		var errors int
+		for _, problem := range lintPackage(p) {
+			l.Println(*fFile + ": " + problem.String())
+			if problem.Severity == lintError {
+				errors++
+			}
+		}
+		if errors > 0 {
+			l.Fatalf("%d errors found in %q\n", errors, *fFile)
+		}
+		return
+	}
+
+	// If dependencies should be inferred, add them before anything is
+	// made from the Package.
+	if p.Build != nil && p.Build.InferDepends {
+		l.Debugf("Inferring dependencies for %q\n", *fType)
+		p.addInferredDepends(*fType)
+	}
+
+	// If a builder was selected, build the packages and report where
+	// they were written. The binaries must already be built, so the
+	// shared libraries they need can be found first.
+	if b != nil {
+		if p.Build != nil && p.Build.Shlibs != nil {
+			l.Debugf("Finding shared library dependencies for %q\n", *fType)
+			err = p.addShlibsDepends(*fType)
+			if err != nil {
+				l.Fatalf("Could not find shared library dependencies: %s", err)
+			}
+		}
+		l.Debugf("Trying to build package with type %q\n", *fType)
+		filenames, err := b.Build(p)
+		if err != nil {
+			l.Fatalf("Could not build package: %s", err)
+		}
+		for _, filename := range filenames {
+			l.Println("Built " + filename)
+		}
+		return
+	}
+
+	// Otherwise, move on to creating the framework with the
+	// previously selected type.
 	l.Debugf("Trying to create framework with type %q\n", *fType)
 	err = fw.Framework(p)
 	if err != nil {
@@ -123,14 +209,16 @@ func CreateSanepack(filename string) (err error) {
 	defer f.Close()
 	l.Debugf("File %q opened for writing\n", filename)
 
-	// MarshalIndent() a template Package, then write it to the
-	// file. Note the call to templatePackage().
-	b, err := json.MarshalIndent(templatePackage(), "", "\t")
+	// Encode a template Package in the format indicated by the
+	// filename, then write it to the file. Note the call to
+	// templatePackage().
+	buf := new(bytes.Buffer)
+	err = encodePackage(filename, buf, templatePackage())
 	if err != nil {
-		l.Debug("JSON Marshalling failed\n")
+		l.Debug("Encoding failed\n")
 		return
 	}
-	n, err := f.Write(b)
+	n, err := f.Write(buf.Bytes())
 	if err != nil {
 		// If the write fails, of course, return.
 		l.Debug("File writing failed\n")
@@ -161,3 +249,51 @@ func concat(sep string, items ...string) (concatenated string) {
 	}
 	return
 }
+
+// shellQuote quotes the given string so that it is interpreted by the
+// shell as a single word, with no expansion.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// wrap splits the given text into paragraphs and wraps each so that
+// no line is longer than width, where possible. Paragraphs are
+// separated by blank lines, which are returned as empty strings. Lines
+// which begin with whitespace are treated as preformatted and are
+// returned unchanged.
+func wrap(text string, width int) (lines []string) {
+	var words []string
+	// flush wraps the words of the current paragraph.
+	flush := func() {
+		line := ""
+		for _, word := range words {
+			if len(line) > 0 && len(line)+1+len(word) > width {
+				lines = append(lines, line)
+				line = ""
+			}
+			if len(line) > 0 {
+				line += " "
+			}
+			line += word
+		}
+		if len(line) > 0 {
+			lines = append(lines, line)
+		}
+		words = nil
+	}
+
+	for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+		switch {
+		case len(strings.TrimSpace(line)) == 0:
+			flush()
+			lines = append(lines, "")
+		case line[0] == ' ' || line[0] == '\t':
+			flush()
+			lines = append(lines, strings.TrimRight(line, " \t"))
+		default:
+			words = append(words, strings.Fields(line)...)
+		}
+	}
+	flush()
+	return
+}
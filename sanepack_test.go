@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/inhies/go-utils/log"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Only warnings and errors are logged, as by default, and they
+	// are discarded.
+	l, _ = log.NewLevel(log.WARNING, true, ioutil.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"one two three", 80, []string{"one two three"}},
+		{"one two three", 7, []string{"one two", "three"}},
+		{"one two three", 3, []string{"one", "two", "three"}},
+		{"unbreakable", 4, []string{"unbreakable"}},
+		{"one\ntwo", 80, []string{"one two"}},
+		{"\n\none\n\n", 80, []string{"one"}},
+		{"one\n\ntwo", 80, []string{"one", "", "two"}},
+		{"one\n  \ntwo", 80, []string{"one", "", "two"}},
+		{"one\n  code  here  \ntwo", 80, []string{"one", "  code  here", "two"}},
+		{"one\n\tcode", 80, []string{"one", "\tcode"}},
+	}
+	for _, test := range tests {
+		lines := wrap(test.text, test.width)
+		if !reflect.DeepEqual(lines, test.want) {
+			t.Errorf("wrap(%q, %d) = %q, want %q", test.text, test.width,
+				lines, test.want)
+		}
+	}
+}
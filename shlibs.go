@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bufio"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ShlibsOptions control how the shared libraries needed by the ELF
+// binaries of a package are found and added to its Depends, in the
+// same way as dpkg-shlibdeps, when the package is built by sanepack.
+type ShlibsOptions struct {
+	// Resolver finds the package which provides each library. It is
+	// "dpkg," which reads the local dpkg database, "rpm," which
+	// queries the local RPM database, or "file," which uses only the
+	// File. If it is empty, the database of the package type is used.
+	Resolver string `json:",omitempty"`
+
+	// File is the path (relative to the top of the package
+	// repository) of a JSON object mapping sonames, such as
+	// "libssl.so.3," to the relations which satisfy them, such as
+	// "libssl3 (>= 3.0.0)." It is consulted before the Resolver.
+	File string `json:",omitempty"`
+
+	// Ignore is a list of sonames which are not added to Depends,
+	// such as those of libraries which are loaded only if present.
+	Ignore []string `json:",omitempty"`
+}
+
+// A neededLibrary is a shared library which an ELF binary needs, as
+// given by a DT_NEEDED entry.
+type neededLibrary struct {
+	// Soname is the name of the library, such as "libc.so.6."
+	Soname string
+
+	// Class is the class of the binary, which tells 32 and 64 bit
+	// libraries of the same name apart.
+	Class elf.Class
+
+	// Symbols are the versioned symbols which the binary uses from
+	// the library, as "name@version," such as "memcpy@GLIBC_2.14."
+	Symbols []string
+}
+
+// A shlibResolver finds the package which provides a shared library.
+type shlibResolver interface {
+	// Resolve returns the relations which satisfy the needed library,
+	// separated by commas, such as "libc6 (>= 2.34)," or an empty
+	// string if the library is not known.
+	Resolve(lib *neededLibrary) (string, error)
+}
+
+// shlibResolvers are the resolvers which may be named in
+// ShlibsOptions, and the default resolver of each package type.
+var (
+	shlibResolvers = map[string]func() shlibResolver{
+		"dpkg": func() shlibResolver { return &dpkgResolver{dir: dpkgInfoDir} },
+		"rpm":  func() shlibResolver { return rpmResolver{} },
+		"file": nil,
+	}
+	shlibDefaultResolvers = map[string]string{
+		"deb": "dpkg",
+		"rpm": "rpm",
+	}
+)
+
+// addShlibsDepends adds the packages providing the shared libraries
+// needed by the installed ELF binaries to the Depends of the binary
+// packages which install them. Relations already given without a
+// version are replaced by the versioned ones which are found.
+func (p *Package) addShlibsDepends(packageType string) (err error) {
+	options := p.Build.Shlibs
+	var resolvers []shlibResolver
+	if len(options.File) > 0 {
+		r, err := newFileResolver(options.File)
+		if err != nil {
+			return err
+		}
+		resolvers = append(resolvers, r)
+	}
+	name := options.Resolver
+	if len(name) == 0 {
+		name = shlibDefaultResolvers[packageType]
+	}
+	if len(name) > 0 {
+		newResolver, ok := shlibResolvers[name]
+		if !ok {
+			return errors.New("unknown shared library resolver " + name +
+				"; run 'sanepack lint' for details")
+		}
+		if newResolver != nil {
+			resolvers = append(resolvers, newResolver())
+		}
+	}
+	if len(resolvers) == 0 {
+		return errors.New("no shared library resolver for package type " +
+			packageType)
+	}
+
+	if len(p.Packages) == 0 {
+		depends, err := shlibsDepends(p.Install, resolvers, options.Ignore)
+		if err != nil {
+			return err
+		}
+		p.Depends = mergeRelations(p.Depends, depends)
+		return nil
+	}
+	for _, b := range p.Packages {
+		depends, err := shlibsDepends(b.Install, resolvers, options.Ignore)
+		if err != nil {
+			return err
+		}
+		b.Depends = mergeRelations(b.Depends, depends)
+	}
+	return
+}
+
+// shlibsDepends reads every ELF file installed by the given Install
+// lines and returns the relations which satisfy the libraries they
+// need, one per package, with the greatest minimum version required
+// by any of them. A library may be satisfied by several relations,
+// given as a list separated by commas. Libraries which are installed
+// alongside the binaries, or which are ignored, are skipped. Libraries
+// which no resolver knows are reported, but are not an error.
+func shlibsDepends(install []string, resolvers []shlibResolver, ignore []string) (depends []Relation, err error) {
+	var files []string
+	for _, line := range install {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.New("malformed install line " + line)
+		}
+		matches, err := filepath.Glob(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			err = filepath.WalkDir(match, func(name string, d fs.DirEntry, err error) error {
+				if err == nil && d.Type().IsRegular() {
+					files = append(files, name)
+				}
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	needed, err := neededLibraries(files)
+	if err != nil {
+		return
+	}
+
+	// The relations are indexed by package, so that each is given
+	// only once with the greatest version.
+	index := make(map[string]int)
+	for _, lib := range needed {
+		if contains(ignore, lib.Soname) {
+			continue
+		}
+		provided := false
+		for _, file := range files {
+			if filepath.Base(file) == lib.Soname {
+				provided = true
+			}
+		}
+		if provided {
+			continue
+		}
+
+		var relation string
+		for _, r := range resolvers {
+			relation, err = r.Resolve(lib)
+			if err != nil {
+				return nil, err
+			}
+			if len(relation) > 0 {
+				break
+			}
+		}
+		if len(relation) == 0 {
+			l.Warningf("No package found which provides %q\n", lib.Soname)
+			continue
+		}
+		l.Debugf("Found %q for %q\n", relation, lib.Soname)
+
+		parsed, err := parseRelations(relation)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range parsed {
+			i, ok := index[r.Name]
+			switch {
+			case !ok:
+				index[r.Name] = len(depends)
+				depends = append(depends, r)
+			case compareDebianVersions(r.Version, depends[i].Version) > 0:
+				depends[i] = r
+			}
+		}
+	}
+	return
+}
+
+// neededLibraries reads the DT_NEEDED entries and versioned symbols
+// of the given files. Files which are not ELF, such as scripts, are
+// skipped.
+func neededLibraries(files []string) (needed []*neededLibrary, err error) {
+	bySoname := make(map[string]*neededLibrary)
+	for _, file := range files {
+		f, err := elf.Open(file)
+		if err != nil {
+			var formatErr *elf.FormatError
+			if errors.As(err, &formatErr) {
+				continue
+			}
+			return nil, err
+		}
+		libs, err := f.ImportedLibraries()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		// Binaries which are statically linked have no dynamic
+		// symbols.
+		symbols, err := f.ImportedSymbols()
+		f.Close()
+		if err != nil && !errors.Is(err, elf.ErrNoSymbols) {
+			return nil, err
+		}
+
+		for _, soname := range libs {
+			key := soname + "/" + f.Class.String()
+			if bySoname[key] == nil {
+				bySoname[key] = &neededLibrary{Soname: soname, Class: f.Class}
+				needed = append(needed, bySoname[key])
+			}
+		}
+		for _, s := range symbols {
+			lib := bySoname[s.Library+"/"+f.Class.String()]
+			if lib == nil || len(s.Version) == 0 {
+				continue
+			}
+			symbol := s.Name + "@" + s.Version
+			if !contains(lib.Symbols, symbol) {
+				lib.Symbols = append(lib.Symbols, symbol)
+			}
+		}
+	}
+	return
+}
+
+// fileResolver resolves libraries from a JSON object mapping sonames
+// to relations.
+type fileResolver map[string]string
+
+func newFileResolver(filename string) (r fileResolver, err error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(contents, &r)
+	return
+}
+
+func (r fileResolver) Resolve(lib *neededLibrary) (string, error) {
+	return r[lib.Soname], nil
+}
+
+// dpkgInfoDir is the directory of the dpkg database which lists the
+// files of every installed package.
+const dpkgInfoDir = "/var/lib/dpkg/info"
+
+// dpkgResolver resolves libraries from the dpkg database, finding the
+// package which installed each library and the minimum version of it
+// from its symbols or shlibs file.
+type dpkgResolver struct {
+	dir string
+
+	// owners maps sonames to the names of the .list files of the
+	// packages which install them, such as "libc6:amd64." It is read
+	// when it is first needed.
+	owners map[string][]string
+}
+
+func (r *dpkgResolver) Resolve(lib *neededLibrary) (relation string, err error) {
+	if r.owners == nil {
+		err = r.readOwners()
+		if err != nil {
+			return
+		}
+	}
+	for _, owner := range r.owners[lib.Soname] {
+		relation, err = r.symbols(owner, lib)
+		if err != nil || len(relation) > 0 {
+			return
+		}
+		relation, err = r.shlibs(owner, lib)
+		if err != nil || len(relation) > 0 {
+			return
+		}
+	}
+
+	// Without a symbols or shlibs file, the package which installed
+	// the library is required without a version.
+	if owners := r.owners[lib.Soname]; len(owners) > 0 {
+		return strings.SplitN(owners[0], ":", 2)[0], nil
+	}
+	return
+}
+
+// readOwners reads the file lists of every installed package, and
+// notes those which install shared libraries.
+func (r *dpkgResolver) readOwners() error {
+	r.owners = make(map[string][]string)
+	lists, err := filepath.Glob(filepath.Join(r.dir, "*.list"))
+	if err != nil {
+		return err
+	}
+	for _, list := range lists {
+		owner := strings.TrimSuffix(filepath.Base(list), ".list")
+		f, err := os.Open(list)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			name := path.Base(scanner.Text())
+			if strings.Contains(scanner.Text(), "/lib") &&
+				strings.Contains(name, ".so") &&
+				!contains(r.owners[name], owner) {
+				r.owners[name] = append(r.owners[name], owner)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// symbols finds the relation for the library from the symbols file of
+// its owner. The minimum version is the greatest of those of the
+// symbols which are used. Symbols may be given by name, or, with the
+// "(symver)" tag, by version alone.
+func (r *dpkgResolver) symbols(owner string, lib *neededLibrary) (relation string, err error) {
+	f, err := os.Open(filepath.Join(r.dir, owner+".symbols"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+
+	var template, minimum string
+	found := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case len(line) == 0 || line[0] == '|' || line[0] == '*' || line[0] == '#':
+			continue
+		case line[0] != ' ':
+			// Each library begins with its soname and the template
+			// of the relation, such as "libc.so.6 libc6 #MINVER#."
+			fields := strings.SplitN(line, " ", 2)
+			found = fields[0] == lib.Soname && len(fields) == 2
+			if found {
+				template = strings.TrimSpace(fields[1])
+			}
+			continue
+		case !found:
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		symbol, version := fields[0], fields[1]
+		symver := strings.HasPrefix(symbol, "(symver)")
+		for strings.HasPrefix(symbol, "(") && strings.Contains(symbol, ")") {
+			symbol = symbol[strings.Index(symbol, ")")+1:]
+		}
+		for _, used := range lib.Symbols {
+			if used == symbol || (symver && strings.HasSuffix(used, "@"+symbol)) {
+				if compareDebianVersions(version, minimum) > 0 {
+					minimum = version
+				}
+				break
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil || len(template) == 0 {
+		return
+	}
+
+	// #MINVER# is replaced where it appears, since the template may
+	// be a list of several relations.
+	minver := ""
+	if len(minimum) > 0 {
+		minver = "(>= " + minimum + ")"
+	}
+	relation = strings.TrimSpace(strings.Replace(template, "#MINVER#", minver, 1))
+	return
+}
+
+// shlibs finds the relation for the library from the shlibs file of
+// its owner, in which each line gives the name and version of a
+// library, split from the soname, followed by the relations which
+// satisfy it.
+func (r *dpkgResolver) shlibs(owner string, lib *neededLibrary) (relation string, err error) {
+	contents, err := os.ReadFile(filepath.Join(r.dir, owner+".shlibs"))
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return
+	}
+
+	// Sonames are either of the form "libfoo.so.1" or "libfoo-1.so."
+	name, version := lib.Soname, ""
+	if i := strings.Index(name, ".so."); i >= 0 {
+		name, version = name[:i], name[i+len(".so."):]
+	} else if i := strings.LastIndex(name, "-"); i >= 0 && strings.HasSuffix(name, ".so") {
+		name, version = name[:i], strings.TrimSuffix(name[i+1:], ".so")
+	}
+
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+			// Lines may begin with a type, such as "udeb:".
+			continue
+		}
+		if len(fields) >= 3 && fields[0] == name && fields[1] == version {
+			return concat(" ", fields[2:]...), nil
+		}
+	}
+	return
+}
+
+// rpmResolver resolves libraries by querying the local RPM database
+// for the package which provides each soname. No version is given, as
+// RPM adds the versioned soname requirements itself.
+type rpmResolver struct{}
+
+func (rpmResolver) Resolve(lib *neededLibrary) (string, error) {
+	// 64 bit libraries are provided as "libfoo.so.1()(64bit)."
+	capability := lib.Soname
+	if lib.Class == elf.ELFCLASS64 {
+		capability += "()(64bit)"
+	}
+	output, err := exec.Command("rpm", "-q", "--whatprovides",
+		"--queryformat", "%{NAME}\n", capability).Output()
+	if err != nil {
+		// rpm fails if nothing provides the capability.
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0]), nil
+}
+
+// compareDebianVersions compares two versions as dpkg does, and
+// returns a negative number if a is older than b, zero if they are
+// the same, and a positive number if a is newer. An empty version is
+// older than any other.
+func compareDebianVersions(a, b string) int {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) - len(b)
+	}
+	epochA, upstreamA, revisionA := splitDebianVersion(a)
+	epochB, upstreamB, revisionB := splitDebianVersion(b)
+	if epochA != epochB {
+		return epochA - epochB
+	}
+	if c := compareVersionParts(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return compareVersionParts(revisionA, revisionB)
+}
+
+// splitDebianVersion splits a version into its epoch, upstream
+// version, and revision.
+func splitDebianVersion(version string) (epoch int, upstream, revision string) {
+	if i := strings.Index(version, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(version[:i])
+		version = version[i+1:]
+	}
+	if i := strings.LastIndex(version, "-"); i >= 0 {
+		return epoch, version[:i], version[i+1:]
+	}
+	return epoch, version, ""
+}
+
+// compareVersionParts compares upstream versions or revisions in the
+// same way as dpkg. They are compared in alternating runs of non-digits
+// and digits. Non-digits are compared character by character, with
+// letters sorting before other characters, and "~" before anything,
+// even the end of the string. Digits are compared numerically.
+func compareVersionParts(a, b string) int {
+	order := func(s string, i int) int {
+		switch c := s[i]; {
+		case c == '~':
+			return -1
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+			return int(c)
+		default:
+			return int(c) + 256
+		}
+	}
+	isDigit := func(s string, i int) bool {
+		return i < len(s) && '0' <= s[i] && s[i] <= '9'
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a, i)) || (j < len(b) && !isDigit(b, j)) {
+			ca, cb := 0, 0
+			if i < len(a) && !isDigit(a, i) {
+				ca = order(a, i)
+			}
+			if j < len(b) && !isDigit(b, j) {
+				cb = order(b, j)
+			}
+			if ca != cb {
+				return ca - cb
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		diff := 0
+		for isDigit(a, i) && isDigit(b, j) {
+			if diff == 0 {
+				diff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if isDigit(a, i) {
+			return 1
+		}
+		if isDigit(b, j) {
+			return -1
+		}
+		if diff != 0 {
+			return diff
+		}
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareDebianVersions(t *testing.T) {
+	// Each pair is given with a older than b, or equal if same is set.
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"1.0", "1.0", true},
+		{"1.0", "1.00", true},
+		{"1.01", "1.1", true},
+		{"0:1.0", "1.0", true},
+		{"1.0-1", "1.0-1", true},
+		{"", "0", false},
+		{"1.0", "1.1", false},
+		{"1.9", "1.10", false},
+		{"1.0", "1.0.1", false},
+		{"1.0", "1.0a", false},
+		{"1.0a", "1.0b", false},
+		{"1.0~rc1", "1.0", false},
+		{"1.0~~", "1.0~", false},
+		{"1.0~rc1", "1.0~rc2", false},
+		{"1.0", "1.0+git1", false},
+		{"1.0+b", "1.0.1", false},
+		{"1.0-1", "1.0-2", false},
+		{"1.0-9", "1.0-10", false},
+		{"1.0", "1.0-1", false},
+		{"9.9", "1:0.1", false},
+		{"1:9.9", "2:0.1", false},
+		{"2:1.21~2", "2:1.21", false},
+		{"2.34", "2.34-0ubuntu1", false},
+		{"1.0-1~bpo1", "1.0-1", false},
+	}
+	for _, test := range tests {
+		c := compareDebianVersions(test.a, test.b)
+		switch {
+		case test.same && c != 0:
+			t.Errorf("compareDebianVersions(%q, %q) = %d, want 0", test.a, test.b, c)
+		case !test.same && c >= 0:
+			t.Errorf("compareDebianVersions(%q, %q) = %d, want < 0", test.a, test.b, c)
+		case !test.same && compareDebianVersions(test.b, test.a) <= 0:
+			t.Errorf("compareDebianVersions(%q, %q) = %d, want > 0", test.b, test.a,
+				compareDebianVersions(test.b, test.a))
+		}
+	}
+}
+
+func TestDpkgResolver(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"libfoo1:amd64.list": "/usr/lib/x86_64-linux-gnu/libfoo.so.1\n",
+		"libfoo1:amd64.symbols": "libfoo.so.1 libfoo1 #MINVER#, libfoo-data\n" +
+			"* Build-Depends-Package: libfoo-dev\n" +
+			" foo@Base 1.0\n" +
+			" bar@Base 1.2\n",
+		"libbar2.list":   "/usr/lib/libbar-2.so\n",
+		"libbar2.shlibs": "libbar 2 libbar2 (>= 2.1), libbar-data\n",
+		"libbaz0.list":   "/usr/lib/libbaz.so.0\n",
+	}
+	for name, contents := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		lib  neededLibrary
+		want string
+	}{
+		{
+			neededLibrary{Soname: "libfoo.so.1", Symbols: []string{"bar@Base"}},
+			"libfoo1 (>= 1.2), libfoo-data",
+		},
+		{neededLibrary{Soname: "libbar-2.so"}, "libbar2 (>= 2.1), libbar-data"},
+		{neededLibrary{Soname: "libbaz.so.0"}, "libbaz0"},
+		{neededLibrary{Soname: "libqux.so.1"}, ""},
+	}
+	r := &dpkgResolver{dir: dir}
+	for _, test := range tests {
+		relation, err := r.Resolve(&test.lib)
+		if err != nil {
+			t.Errorf("Resolve(%q): %s", test.lib.Soname, err)
+		} else if relation != test.want {
+			t.Errorf("Resolve(%q) = %q, want %q", test.lib.Soname,
+				relation, test.want)
+		}
+	}
+}
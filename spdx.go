@@ -0,0 +1,366 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// spdxLicenses map the SPDX identifiers of known licenses to their
+// Debian short names, as used in debian/copyright.
+var spdxLicenses = map[string]string{
+	"0BSD":              "0BSD",
+	"AGPL-3.0-only":     "AGPL-3",
+	"AGPL-3.0-or-later": "AGPL-3+",
+	"Apache-1.1":        "Apache-1.1",
+	"Apache-2.0":        "Apache-2.0",
+	"Artistic-1.0-Perl": "Artistic",
+	"Artistic-2.0":      "Artistic-2.0",
+	"BSD-2-Clause":      "BSD-2-clause",
+	"BSD-3-Clause":      "BSD-3-clause",
+	"BSD-4-Clause":      "BSD-4-clause",
+	"BSL-1.0":           "BSL-1.0",
+	"CC-BY-3.0":         "CC-BY-3.0",
+	"CC-BY-4.0":         "CC-BY-4.0",
+	"CC-BY-SA-3.0":      "CC-BY-SA-3.0",
+	"CC-BY-SA-4.0":      "CC-BY-SA-4.0",
+	"CC0-1.0":           "CC0-1.0",
+	"CDDL-1.0":          "CDDL-1.0",
+	"EPL-1.0":           "EPL-1.0",
+	"EPL-2.0":           "EPL-2.0",
+	"EUPL-1.2":          "EUPL-1.2",
+	"GFDL-1.3-only":     "GFDL-1.3",
+	"GFDL-1.3-or-later": "GFDL-1.3+",
+	"GPL-1.0-or-later":  "GPL-1+",
+	"GPL-2.0-only":      "GPL-2",
+	"GPL-2.0-or-later":  "GPL-2+",
+	"GPL-3.0-only":      "GPL-3",
+	"GPL-3.0-or-later":  "GPL-3+",
+	"ISC":               "ISC",
+	"LGPL-2.0-only":     "LGPL-2",
+	"LGPL-2.0-or-later": "LGPL-2+",
+	"LGPL-2.1-only":     "LGPL-2.1",
+	"LGPL-2.1-or-later": "LGPL-2.1+",
+	"LGPL-3.0-only":     "LGPL-3",
+	"LGPL-3.0-or-later": "LGPL-3+",
+	"MIT":               "Expat",
+	"MIT-0":             "MIT-0",
+	"MPL-1.1":           "MPL-1.1",
+	"MPL-2.0":           "MPL-2.0",
+	"OFL-1.1":           "OFL-1.1",
+	"PostgreSQL":        "PostgreSQL",
+	"PSF-2.0":           "PSF-2.0",
+	"Python-2.0":        "Python-2.0",
+	"Unlicense":         "Unlicense",
+	"WTFPL":             "WTFPL",
+	"X11":               "X11",
+	"Zlib":              "Zlib",
+}
+
+// spdxAliases map deprecated SPDX identifiers, and the Debian short
+// names which sanepack files used before SPDX was understood, to the
+// current SPDX identifiers.
+var spdxAliases = map[string]string{
+	"AGPL-3.0":  "AGPL-3.0-only",
+	"GPL-2.0":   "GPL-2.0-only",
+	"GPL-3.0":   "GPL-3.0-only",
+	"LGPL-2.0":  "LGPL-2.0-only",
+	"LGPL-2.1":  "LGPL-2.1-only",
+	"LGPL-3.0":  "LGPL-3.0-only",
+	"GFDL-1.3":  "GFDL-1.3-only",
+	"Expat":     "MIT",
+	"Artistic":  "Artistic-1.0-Perl",
+	"GPL-1+":    "GPL-1.0-or-later",
+	"GPL-2":     "GPL-2.0-only",
+	"GPL-2+":    "GPL-2.0-or-later",
+	"GPL-3":     "GPL-3.0-only",
+	"GPL-3+":    "GPL-3.0-or-later",
+	"LGPL-2":    "LGPL-2.0-only",
+	"LGPL-2+":   "LGPL-2.0-or-later",
+	"LGPL-2.1+": "LGPL-2.1-or-later",
+	"LGPL-3":    "LGPL-3.0-only",
+	"LGPL-3+":   "LGPL-3.0-or-later",
+	"AGPL-3":    "AGPL-3.0-only",
+	"AGPL-3+":   "AGPL-3.0-or-later",
+	"GFDL-1.3+": "GFDL-1.3-or-later",
+}
+
+// spdxExceptions map the SPDX identifiers of known license exceptions
+// to the names by which Debian knows them, as in "GPL-2+ with
+// Classpath exception."
+var spdxExceptions = map[string]string{
+	"Autoconf-exception-3.0":       "Autoconf",
+	"Bison-exception-2.2":          "Bison",
+	"Classpath-exception-2.0":      "Classpath",
+	"Font-exception-2.0":           "Font",
+	"GCC-exception-3.1":            "GCC",
+	"LLVM-exception":               "LLVM",
+	"Linux-syscall-note":           "Linux-syscall-note",
+	"OCaml-LGPL-linking-exception": "OCaml-linking",
+	"Qt-GPL-exception-1.0":         "Qt",
+}
+
+// A licenseExpr is a parsed SPDX license expression. It is either a
+// single license, with an optional exception, or a conjunction ("AND")
+// or disjunction ("OR") of other expressions.
+type licenseExpr struct {
+	// ID is the SPDX identifier of a single license, such as
+	// "GPL-3.0-or-later," and Exception is the identifier of its
+	// exception, if any. Plus is set if the license was given with
+	// "+," meaning "or any later version," and could not be replaced
+	// with an "-or-later" identifier.
+	ID, Exception string
+	Plus          bool
+
+	// Op is "AND" or "OR" for compound expressions, which are made up
+	// of the Terms.
+	Op    string
+	Terms []*licenseExpr
+}
+
+// parseLicense parses an SPDX license expression, such as "MIT OR
+// Apache-2.0." Identifiers are matched without regard to case, and
+// deprecated identifiers are replaced by their current forms, so that
+// the String of the result is the canonical form of the expression.
+// Unknown licenses and exceptions are rejected.
+func parseLicense(s string) (expr *licenseExpr, err error) {
+	p := &licenseParser{tokens: licenseTokens(s)}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty license expression")
+	}
+	expr, err = p.or()
+	if err == nil && p.pos < len(p.tokens) {
+		err = errors.New("unexpected " + p.tokens[p.pos])
+	}
+	return
+}
+
+// licenseTokens splits an expression into identifiers, operators, and
+// parentheses.
+func licenseTokens(s string) []string {
+	s = strings.Replace(s, "(", " ( ", -1)
+	s = strings.Replace(s, ")", " ) ", -1)
+	return strings.Fields(s)
+}
+
+// A licenseParser is a recursive descent parser of license
+// expressions, in which "WITH" binds most tightly, followed by "AND"
+// and then "OR."
+type licenseParser struct {
+	tokens []string
+	pos    int
+}
+
+// next returns the next token without consuming it, or an empty
+// string at the end of the expression.
+func (p *licenseParser) next() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *licenseParser) or() (*licenseExpr, error) {
+	return p.compound("OR", p.and)
+}
+
+func (p *licenseParser) and() (*licenseExpr, error) {
+	return p.compound("AND", p.with)
+}
+
+// compound parses terms separated by the given operator.
+func (p *licenseParser) compound(op string, term func() (*licenseExpr, error)) (expr *licenseExpr, err error) {
+	expr, err = term()
+	if err != nil {
+		return
+	}
+	for strings.EqualFold(p.next(), op) {
+		p.pos++
+		t, err := term()
+		if err != nil {
+			return nil, err
+		}
+		if expr.Op != op {
+			expr = &licenseExpr{Op: op, Terms: []*licenseExpr{expr}}
+		}
+		expr.Terms = append(expr.Terms, t)
+	}
+	return
+}
+
+func (p *licenseParser) with() (expr *licenseExpr, err error) {
+	token := p.next()
+	p.pos++
+	switch {
+	case len(token) == 0:
+		return nil, errors.New("unexpected end of expression")
+	case token == "(":
+		expr, err = p.or()
+		if err != nil {
+			return
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing )")
+		}
+		p.pos++
+		return
+	case token == ")" || isLicenseOperator(token):
+		return nil, errors.New("unexpected " + token)
+	}
+
+	expr, err = newLicense(token)
+	if err != nil || !strings.EqualFold(p.next(), "WITH") {
+		return
+	}
+	p.pos++
+	exception := p.next()
+	p.pos++
+	for id := range spdxExceptions {
+		if strings.EqualFold(id, exception) {
+			expr.Exception = id
+			return
+		}
+	}
+	return nil, errors.New("unknown license exception " + exception)
+}
+
+// isLicenseOperator reports whether the token is an operator.
+func isLicenseOperator(token string) bool {
+	for _, op := range []string{"AND", "OR", "WITH"} {
+		if strings.EqualFold(token, op) {
+			return true
+		}
+	}
+	return false
+}
+
+// newLicense creates the expression for a single license identifier,
+// which may end in "+."
+func newLicense(id string) (*licenseExpr, error) {
+	expr := new(licenseExpr)
+	if canonical, ok := spdxID(id); ok {
+		expr.ID = canonical
+		return expr, nil
+	}
+	if !strings.HasSuffix(id, "+") {
+		return nil, errors.New("unknown license " + id)
+	}
+	canonical, ok := spdxID(strings.TrimSuffix(id, "+"))
+	if !ok {
+		return nil, errors.New("unknown license " + id)
+	}
+
+	// "GPL-2.0+" is the same as "GPL-2.0-or-later," but licenses
+	// without an "-or-later" form keep the "+."
+	expr.ID = canonical
+	if strings.HasSuffix(canonical, "-only") {
+		later := strings.TrimSuffix(canonical, "-only") + "-or-later"
+		if _, ok := spdxLicenses[later]; ok {
+			expr.ID = later
+			return expr, nil
+		}
+	}
+	expr.Plus = true
+	return expr, nil
+}
+
+// spdxID returns the canonical SPDX identifier of the given license
+// identifier or alias.
+func spdxID(id string) (string, bool) {
+	for canonical := range spdxLicenses {
+		if strings.EqualFold(canonical, id) {
+			return canonical, true
+		}
+	}
+	for alias, canonical := range spdxAliases {
+		if strings.EqualFold(alias, id) {
+			return canonical, true
+		}
+	}
+	return "", false
+}
+
+// String returns the expression in canonical SPDX form.
+func (e *licenseExpr) String() string {
+	return e.format(func(e *licenseExpr) string {
+		s := e.ID
+		if e.Plus {
+			s += "+"
+		}
+		if len(e.Exception) > 0 {
+			s += " WITH " + e.Exception
+		}
+		return s
+	}, "(", ")")
+}
+
+// Debian returns the expression as in debian/copyright, such as
+// "GPL-2+ with Classpath exception or Expat."
+func (e *licenseExpr) Debian() string {
+	return e.format(debianLicenseName, "", "")
+}
+
+// debianLicenseName returns the Debian name of a single license.
+func debianLicenseName(e *licenseExpr) string {
+	s := spdxLicenses[e.ID]
+	if e.Plus {
+		s += "+"
+	}
+	if len(e.Exception) > 0 {
+		s += " with " + spdxExceptions[e.Exception] + " exception"
+	}
+	return s
+}
+
+// format formats the expression, using name to format each single
+// license. Compound terms within compound expressions are placed in
+// the given parentheses. If there are none, as in debian/copyright,
+// operators are written in lowercase, and compound terms are moved to
+// the front, each followed by a comma to separate it from the operator
+// which follows.
+func (e *licenseExpr) format(name func(*licenseExpr) string, open, close string) (s string) {
+	if len(e.Op) == 0 {
+		return name(e)
+	}
+	op, terms := e.Op, e.Terms
+	if len(open) == 0 {
+		op = strings.ToLower(op)
+		terms = append([]*licenseExpr(nil), terms...)
+		sort.SliceStable(terms, func(i, j int) bool {
+			return len(terms[i].Op) > 0 && len(terms[j].Op) == 0
+		})
+	}
+	for i, t := range terms {
+		term := t.format(name, open, close)
+		if i > 0 {
+			s += " " + op + " "
+		}
+		if len(t.Op) > 0 {
+			if len(open) > 0 {
+				term = open + term + close
+			} else if i+1 < len(terms) {
+				term += ","
+			}
+		}
+		s += term
+	}
+	return
+}
+
+// Licenses returns the single licenses which make up the expression,
+// without duplicates, in the order in which they appear.
+func (e *licenseExpr) Licenses() (licenses []*licenseExpr) {
+	if len(e.Op) == 0 {
+		return []*licenseExpr{e}
+	}
+	seen := make(map[string]bool)
+	for _, t := range e.Terms {
+		for _, license := range t.Licenses() {
+			if !seen[license.String()] {
+				seen[license.String()] = true
+				licenses = append(licenses, license)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseLicense(t *testing.T) {
+	tests := []struct {
+		in, canonical, debian string
+	}{
+		{"MIT", "MIT", "Expat"},
+		{"mit", "MIT", "Expat"},
+		{"Expat", "MIT", "Expat"},
+		{"GPL-3+", "GPL-3.0-or-later", "GPL-3+"},
+		{"GPL-2.0", "GPL-2.0-only", "GPL-2"},
+		{"GPL-3.0-or-later", "GPL-3.0-or-later", "GPL-3+"},
+		{"MIT OR Apache-2.0", "MIT OR Apache-2.0", "Expat or Apache-2.0"},
+		{"MIT AND Zlib", "MIT AND Zlib", "Expat and Zlib"},
+		{
+			"GPL-2.0-or-later WITH Classpath-exception-2.0",
+			"GPL-2.0-or-later WITH Classpath-exception-2.0",
+			"GPL-2+ with Classpath exception",
+		},
+		{
+			// AND binds more tightly than OR.
+			"MIT OR Apache-2.0 AND Zlib",
+			"MIT OR (Apache-2.0 AND Zlib)",
+			"Apache-2.0 and Zlib, or Expat",
+		},
+		{
+			"(MIT OR Apache-2.0) AND Zlib",
+			"(MIT OR Apache-2.0) AND Zlib",
+			"Expat or Apache-2.0, and Zlib",
+		},
+	}
+	for _, test := range tests {
+		expr, err := parseLicense(test.in)
+		if err != nil {
+			t.Errorf("parseLicense(%q): %s", test.in, err)
+			continue
+		}
+		if s := expr.String(); s != test.canonical {
+			t.Errorf("parseLicense(%q).String() = %q, want %q",
+				test.in, s, test.canonical)
+		}
+		if s := expr.Debian(); s != test.debian {
+			t.Errorf("parseLicense(%q).Debian() = %q, want %q",
+				test.in, s, test.debian)
+		}
+	}
+}
+
+func TestParseLicenseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"Not-A-License",
+		"MIT OR",
+		"MIT AND AND Zlib",
+		"(MIT OR Zlib",
+		"MIT OR Zlib)",
+		"GPL-2.0-only WITH Not-An-Exception",
+		"MIT Zlib",
+	} {
+		if expr, err := parseLicense(in); err == nil {
+			t.Errorf("parseLicense(%q) = %q, want error", in, expr)
+		}
+	}
+}
+
+func TestLicenses(t *testing.T) {
+	expr, err := parseLicense("MIT OR (Apache-2.0 AND MIT) OR Zlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, license := range expr.Licenses() {
+		ids = append(ids, license.String())
+	}
+	if s, want := concat(" ", ids...), "MIT Apache-2.0 Zlib"; s != want {
+		t.Errorf("Licenses() = %q, want %q", s, want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// svnVCS finds the releases and changes of a Subversion working copy.
+// Releases are the "v*" directories under "^/tags," and because
+// history is linear, the commits made for a release are those between
+// the revisions at which the tags were made.
+type svnVCS struct{}
+
+// svnInfo is the output of "svn info --xml."
+type svnInfo struct {
+	Entry struct {
+		Commit struct {
+			Revision int       `xml:"revision,attr"`
+			Author   string    `xml:"author"`
+			Date     time.Time `xml:"date"`
+		} `xml:"commit"`
+	} `xml:"entry"`
+}
+
+// svnLog is the output of "svn log --xml."
+type svnLog struct {
+	Entries []struct {
+		Revision int    `xml:"revision,attr"`
+		Message  string `xml:"msg"`
+	} `xml:"logentry"`
+}
+
+func (svnVCS) Name() string {
+	return "svn"
+}
+
+// User always fails, because Subversion does not record the name or
+// email of the user.
+func (svnVCS) User() (user Person, err error) {
+	return user, errors.New("svn: user name and email are not recorded")
+}
+
+// Releases returns the releases marked by every "v*" tag, each
+// authored by the user who made the tag.
+func (s svnVCS) Releases() (releases []*vcsRelease, err error) {
+	tags, err := exec.Command("svn", "list", "^/tags").Output()
+	if err != nil {
+		return
+	}
+	for _, tag := range strings.Fields(string(tags)) {
+		tag = strings.TrimSuffix(tag, "/")
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		info, err := s.info("^/tags/" + tag)
+		if err != nil {
+			return nil, err
+		}
+		release := newVCSRelease(tag)
+		release.Date = info.Entry.Commit.Date.UTC()
+		release.Ancestors = info.Entry.Commit.Revision
+		release.Author = Person{Name: info.Entry.Commit.Author}
+		releases = append(releases, release)
+	}
+	return
+}
+
+// Describe finds the most recent tag made at or before the last
+// revision of the working copy.
+func (s svnVCS) Describe() (d *vcsDescription, err error) {
+	info, err := s.info(".")
+	if err != nil {
+		return
+	}
+	d = &vcsDescription{
+		ID:   "r" + strconv.Itoa(info.Entry.Commit.Revision),
+		Date: info.Entry.Commit.Date.UTC(),
+	}
+
+	releases, err := s.Releases()
+	if err != nil {
+		return nil, err
+	}
+	var latest *vcsRelease
+	for _, release := range releases {
+		if release.Ancestors <= info.Entry.Commit.Revision &&
+			(latest == nil || release.Ancestors > latest.Ancestors) {
+			latest = release
+		}
+	}
+	var since string
+	if latest != nil {
+		d.Tag, since = latest.Tag, latest.Tag
+	}
+	commits, err := s.Log(since, "", true)
+	if err != nil {
+		return nil, err
+	}
+	d.Distance = len(commits)
+
+	status, err := exec.Command("svn", "status", "-q").Output()
+	if err != nil {
+		return nil, err
+	}
+	d.Dirty = hasOutput(status)
+	return
+}
+
+// Log returns the commits to the working copy made after the tag since
+// and before the tag until. Subversion has no merge commits.
+func (s svnVCS) Log(since, until string, merges bool) (commits []vcsCommit, err error) {
+	first, last := 1, 0
+	if len(since) > 0 {
+		info, err := s.info("^/tags/" + since)
+		if err != nil {
+			return nil, err
+		}
+		first = info.Entry.Commit.Revision + 1
+	}
+	target := "."
+	if len(until) > 0 {
+		target = "^/tags/" + until
+	}
+	info, err := s.info(target)
+	if err != nil {
+		return
+	}
+	last = info.Entry.Commit.Revision
+	if first > last {
+		return
+	}
+
+	output, err := exec.Command("svn", "log", "--xml", "-r",
+		strconv.Itoa(last)+":"+strconv.Itoa(first), ".").Output()
+	if err != nil {
+		return
+	}
+	log := new(svnLog)
+	err = xml.Unmarshal(output, log)
+	if err != nil {
+		return
+	}
+	for _, entry := range log.Entries {
+		commits = append(commits, newVCSCommit(entry.Message))
+	}
+	return
+}
+
+// info returns the last commit to the given path or URL.
+func (svnVCS) info(target string) (info *svnInfo, err error) {
+	output, err := exec.Command("svn", "info", "--xml", target).Output()
+	if err != nil {
+		return
+	}
+	info = new(svnInfo)
+	err = xml.Unmarshal(output, info)
+	return
+}
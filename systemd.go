@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path"
+	"strings"
+	"text/template"
+)
+
+// systemdUnitTypes are the extensions of the unit types which may be
+// given as Services.
+var systemdUnitTypes = []string{
+	".service", ".socket", ".timer", ".path", ".mount", ".target",
+}
+
+// Unit returns the full name of the unit, such as "foo.service," and
+// uses the given name of the binary package if no other is known.
+func (s *Service) Unit(name string) string {
+	switch {
+	case len(s.Name) > 0:
+		name = s.Name
+	case len(s.File) > 0:
+		name = path.Base(s.File)
+	}
+	for _, ext := range systemdUnitTypes {
+		if strings.HasSuffix(name, ext) {
+			return name
+		}
+	}
+	return name + ".service"
+}
+
+// systemdUnitFile is the data given to the template of a unit file
+// which is described by a Service.
+type systemdUnitFile struct {
+	templateContext
+	*Service
+
+	// WantedBy are the targets of the Service, or "multi-user.target"
+	// if none are given.
+	WantedBy []string
+}
+
+// Contents returns the contents of the unit file, if one is given,
+// or renders the declarative description of the service with
+// "unit.template" from the given templates otherwise.
+func (s *Service) Contents(t *template.Template, ctx templateContext) (string, error) {
+	if len(s.File) > 0 {
+		b, err := ioutil.ReadFile(s.File)
+		return string(b), err
+	}
+	if len(s.ExecStart) == 0 {
+		return "", errors.New("systemd: service has neither File nor ExecStart")
+	}
+
+	unit := &systemdUnitFile{templateContext: ctx, Service: s, WantedBy: s.WantedBy}
+	if len(unit.WantedBy) == 0 {
+		unit.WantedBy = []string{"multi-user.target"}
+	}
+	buf := new(bytes.Buffer)
+	err := t.ExecuteTemplate(buf, "unit.template", unit)
+	return buf.String(), err
+}
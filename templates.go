@@ -0,0 +1,163 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// builtinTemplates are the stock templates, which are compiled into
+// the binary so that sanepack works without any installed files.
+//
+//go:embed templates
+var builtinTemplates embed.FS
+
+// templateFuncs are the helper functions available to every template,
+// in addition to those built into text/template.
+var templateFuncs = template.FuncMap{
+	// relations joins a list of relations, such as Depends, as in a
+	// Debian control file.
+	"relations": debianRelations,
+	// join places the separator between every item in the list.
+	"join": func(sep string, items []string) string {
+		return concat(sep, items...)
+	},
+	// debdesc formats a long description for a Debian control file.
+	"debdesc": debianDescription,
+	// debtext formats text as the continuation lines of a field in a
+	// Debian control or copyright file, without wrapping it.
+	"debtext": debianText,
+	// rfc2822 formats a time as in a Debian changelog or an email.
+	"rfc2822": func(t time.Time) string {
+		return t.Format(time.RFC1123Z)
+	},
+	// wrap wraps text to the given width, as for LongDescription.
+	"wrap": func(width int, text string) string {
+		return concat("\n", wrap(text, width)...)
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// shquote quotes a string for use as a single shell word.
+	"shquote": shellQuote,
+}
+
+// A templateContext is embedded in the data given to every template,
+// so that each may use the whole Package and the values computed from
+// it, as well as the fields specific to the file it creates.
+type templateContext struct {
+	// Package is the Package being packaged.
+	Package *Package
+
+	// UpstreamVersion is the Version of the Package, or the version
+	// found from version control if it is not given.
+	UpstreamVersion string
+
+	// Now is the time at which the files are being created.
+	Now time.Time
+
+	// Date is the time of the current commit, or Now if there is no
+	// version control. Unreleased changelog entries are dated by it,
+	// so that they do not change every time the files are created.
+	Date time.Time
+
+	// Architectures are the architectures of the binary packages,
+	// without duplicates, such as "any" and "all."
+	Architectures []string
+}
+
+// newTemplateContext finds the values computed from the given Package
+// for use in templates.
+func newTemplateContext(p *Package) (c templateContext, err error) {
+	c.Package = p
+	c.Now = time.Now()
+	c.Date = vcsDate()
+	c.UpstreamVersion, err = p.UpstreamVersion()
+	if err != nil {
+		return
+	}
+	for _, b := range p.Binaries() {
+		if !contains(c.Architectures, b.Architecture) {
+			c.Architectures = append(c.Architectures, b.Architecture)
+		}
+	}
+	return
+}
+
+// loadTemplates parses the built in templates for the given framework
+// type, such as "debian," and for any shared types it uses, such as
+// "systemd," and then any templates of the same types in the -temp
+// directory. Templates in the -temp directory replace the built in
+// ones of the same name, so that individual templates can be
+// customized while the rest are left as they are.
+func loadTemplates(dir string, shared ...string) (t *template.Template, err error) {
+	dirs := append([]string{dir}, shared...)
+	t = template.New(dir).Funcs(templateFuncs)
+	for _, dir := range dirs {
+		t, err = t.ParseFS(builtinTemplates,
+			path.Join("templates", dir, "*.template"))
+		if err != nil {
+			return
+		}
+	}
+	if len(*fTemp) == 0 {
+		return
+	}
+
+	var overrides []string
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(*fTemp, dir, "*.template"))
+		if err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, matches...)
+	}
+	if len(overrides) == 0 {
+		return
+	}
+	for _, override := range overrides {
+		l.Debugf("Using template %q\n", override)
+	}
+	return t.ParseFiles(overrides...)
+}
+
+// dumpTemplates writes every built in template into the given
+// directory, in the layout expected of the -temp directory, so that
+// they can be customized. Existing files are not overwritten. It
+// returns the names of the files that were written.
+func dumpTemplates(dir string) (written []string, err error) {
+	err = fs.WalkDir(builtinTemplates, "templates", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel("templates", filepath.FromSlash(name))
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if _, err := os.Stat(target); err == nil {
+			l.Infof("Not overwriting %q\n", target)
+			return nil
+		}
+
+		contents, err := builtinTemplates.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		err = os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(target, contents, 0644)
+		if err != nil {
+			return err
+		}
+		written = append(written, target)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A vcs is a version control system, such as git, which the project
+// may be kept in. It is used to find the current user, the version,
+// and the changes which make up the changelog.
+type vcs interface {
+	// Name is the short name of the version control system, such as
+	// "git," which is used in snapshot versions.
+	Name() string
+
+	// User returns the name and email of the current user, as
+	// configured for the version control system.
+	User() (Person, error)
+
+	// Releases returns the releases marked by every "v*" tag, in any
+	// order.
+	Releases() ([]*vcsRelease, error)
+
+	// Describe finds the most recent release of the working copy and
+	// the changes made since it.
+	Describe() (*vcsDescription, error)
+
+	// Log returns the commits made after the release tagged since and
+	// up to and including the release tagged until, newest first. If
+	// since is empty, every commit up to until is returned, and if
+	// until is empty, commits up to the working copy are returned.
+	// Merges are only included if merges is set.
+	Log(since, until string, merges bool) ([]vcsCommit, error)
+}
+
+// vcsMarkers are the files and directories which mark the top of a
+// working copy, and the version control system they belong to.
+var vcsMarkers = []struct {
+	name string
+	vcs  vcs
+}{
+	{".git", gitVCS{}},
+	{".hg", hgVCS{}},
+	{".fslckout", fossilVCS{}},
+	{"_FOSSIL_", fossilVCS{}},
+	{".svn", svnVCS{}},
+}
+
+var (
+	detectOnce  sync.Once
+	detectedVCS vcs
+)
+
+// findVCS returns the version control system of the working copy
+// containing the current directory, or nil if there is none, as is
+// the case when building from a release tarball. The nearest working
+// copy is used, so that a project kept in git within a Subversion
+// checkout is treated as a git repository.
+func findVCS() vcs {
+	detectOnce.Do(func() {
+		dir, err := os.Getwd()
+		if err != nil {
+			l.Debugf("Could not find version control: %s\n", err)
+			return
+		}
+		for {
+			for _, marker := range vcsMarkers {
+				if _, err := os.Stat(filepath.Join(dir, marker.name)); err == nil {
+					l.Debugf("Found %s working copy at %q\n",
+						marker.vcs.Name(), dir)
+					detectedVCS = marker.vcs
+					return
+				}
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+		l.Debug("No version control found\n")
+	})
+	return detectedVCS
+}
+
+// A vcsCommit is a single commit, with its message split into the
+// subject line and the body.
+type vcsCommit struct {
+	Subject, Body string
+}
+
+// newVCSCommit splits a commit message into the subject line and the
+// body.
+func newVCSCommit(message string) vcsCommit {
+	message = strings.TrimLeft(message, "\n")
+	if i := strings.Index(message, "\n"); i >= 0 {
+		return vcsCommit{message[:i], strings.TrimLeft(message[i+1:], "\n")}
+	}
+	return vcsCommit{Subject: message}
+}
+
+// A vcsRelease is a single release, found from a version control tag.
+type vcsRelease struct {
+	Tag, Version string
+	Date         time.Time
+	Author       Person
+
+	// Ancestors is the number of commits reachable from the tag, or
+	// another measure which increases with every commit, and orders
+	// releases made within the same second.
+	Ancestors int
+
+	// Since is the tag of the previous release, so that the commits
+	// made for this release are those logged since it. It is empty
+	// for the oldest release.
+	Since string
+}
+
+// newVCSRelease creates a release from the given tag, which must begin
+// with "v," such as "v1.2.0."
+func newVCSRelease(tag string) *vcsRelease {
+	return &vcsRelease{Tag: tag, Version: strings.TrimLeft(tag, "vV")}
+}
+
+// A vcsDescription describes the working copy relative to the most
+// recent release.
+type vcsDescription struct {
+	// Tag is the tag of the most recent release, or empty if there
+	// has been none.
+	Tag string
+
+	// Distance is the number of commits since the release, or since
+	// the beginning if there has been none.
+	Distance int
+
+	// ID is the abbreviated identifier of the current commit, such as
+	// "gabc1234."
+	ID string
+
+	// Date is the time of the current commit.
+	Date time.Time
+
+	// Dirty is set if there are uncommitted changes.
+	Dirty bool
+}
+
+// vcsUser returns the name and email of the current user, if there is
+// version control.
+func vcsUser() (user Person, err error) {
+	v := findVCS()
+	if v == nil {
+		return user, errors.New("no version control found")
+	}
+	return v.User()
+}
+
+// vcsChanges reads the version control log and returns the subject
+// line of every commit, newest first, selected as by vcs.Log. If there
+// is no version control, there are no changes.
+func vcsChanges(since, until string) (changes []string, err error) {
+	v := findVCS()
+	if v == nil {
+		return
+	}
+	commits, err := v.Log(since, until, true)
+	for _, commit := range commits {
+		changes = append(changes, commit.Subject)
+	}
+	return
+}
+
+// vcsCommits reads the version control log and returns every commit
+// other than merges, newest first, selected as by vcs.Log.
+func vcsCommits(since, until string) (commits []vcsCommit, err error) {
+	v := findVCS()
+	if v == nil {
+		return
+	}
+	return v.Log(since, until, false)
+}
+
+// vcsReleases reads every "v*" tag and returns the releases they
+// mark, newest first. Each is dated by the commit it marks, and is
+// authored by the tagger, where it is recorded, or by the author of
+// the commit. If there is no version control, there are no releases.
+func vcsReleases() (releases []*vcsRelease, err error) {
+	v := findVCS()
+	if v == nil {
+		return
+	}
+	releases, err = v.Releases()
+	if err != nil {
+		return
+	}
+
+	sort.SliceStable(releases, func(i, j int) bool {
+		if !releases[i].Date.Equal(releases[j].Date) {
+			return releases[i].Date.After(releases[j].Date)
+		}
+		return releases[i].Ancestors > releases[j].Ancestors
+	})
+
+	// Each release includes the commits since the one before it, and
+	// the oldest includes every commit before it.
+	for i, release := range releases {
+		if i+1 < len(releases) {
+			release.Since = releases[i+1].Tag
+		}
+	}
+	return
+}
+
+// vcsVersion finds the most recent release tag and converts it to a
+// version string, which is a snapshot version, as described by
+// snapshotVersion, if there are commits since the tag or uncommitted
+// changes.
+func vcsVersion() (version string, err error) {
+	v := findVCS()
+	if v == nil {
+		return "", errors.New("no version control found; " +
+			"the Version must be given")
+	}
+	d, err := v.Describe()
+	if err != nil {
+		return
+	}
+	return snapshotVersion(v.Name(), d), nil
+}
+
+// snapshotVersion converts the tag of a description to a version
+// string. If there are commits since the tag, or the working copy is
+// dirty, a snapshot version is made from the tag, the name of the
+// version control system, the date of the last commit, the number of
+// commits since the tag, and the abbreviated identifier of the commit,
+// such as "1.2.0+git20130604.5.gabc1234". If there is no tag, the
+// version begins with "0~" so that it sorts before any release.
+func snapshotVersion(name string, d *vcsDescription) (version string) {
+	// The Version is slightly more finnicky than the tag; it must
+	// start with a decimal number, so we trim "v" or "V" from the
+	// left.
+	separator := "+"
+	version = strings.TrimLeft(d.Tag, "vV")
+	if len(d.Tag) == 0 {
+		version, separator = "0", "~"
+	} else if d.Distance == 0 && !d.Dirty {
+		return
+	}
+	version += separator + name + d.Date.UTC().Format("20060102") +
+		"." + strconv.Itoa(d.Distance) + "." + d.ID
+
+	// The dirty marker is separated by a period rather than a hyphen,
+	// because hyphens are not permitted in Debian upstream versions
+	// without a revision, or in RPM versions.
+	if d.Dirty {
+		version += ".dirty"
+	}
+	return
+}
+
+// vcsDate returns the time of the current commit, so that files which
+// are dated by it, such as changelogs, only change with new commits.
+// If there is no version control, or no commit, it returns the current
+// time.
+func vcsDate() time.Time {
+	v := findVCS()
+	if v == nil {
+		return time.Now()
+	}
+	d, err := v.Describe()
+	if err != nil || d.Date.IsZero() {
+		l.Debugf("Using the current time, because the time of the "+
+			"current commit is not known: %v\n", err)
+		return time.Now()
+	}
+	return d.Date
+}
+
+// parsePerson parses a name and email in the form "Name <email>," as
+// used by Mercurial and in changelogs. If there is no email, the whole
+// string is taken as the name.
+func parsePerson(s string) Person {
+	s = strings.TrimSpace(s)
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return Person{Name: addr.Name, Email: addr.Address}
+	}
+	return Person{Name: s}
+}
+
+// hasOutput reports whether the given command output contains
+// anything other than whitespace, such as when a status command lists
+// uncommitted changes.
+func hasOutput(output []byte) bool {
+	return len(strings.TrimSpace(string(output))) > 0
+}
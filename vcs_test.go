@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitDescription(t *testing.T) {
+	tests := []struct {
+		in       string
+		tag      string
+		distance int
+		id       string
+	}{
+		{"v1.2.0-0-gabc1234\n", "v1.2.0", 0, "gabc1234"},
+		{"v1.2.0-5-gabc1234", "v1.2.0", 5, "gabc1234"},
+		{"v1.2.0-rc1-12-g0123abc", "v1.2.0-rc1", 12, "g0123abc"},
+	}
+	for _, test := range tests {
+		tag, distance, id, err := splitDescription(test.in)
+		if err != nil {
+			t.Errorf("splitDescription(%q): %s", test.in, err)
+			continue
+		}
+		if tag != test.tag || distance != test.distance || id != test.id {
+			t.Errorf("splitDescription(%q) = %q, %d, %q, want %q, %d, %q",
+				test.in, tag, distance, id, test.tag, test.distance, test.id)
+		}
+	}
+
+	for _, in := range []string{"v1.2.0", "v1.2.0-x-gabc1234"} {
+		if _, _, _, err := splitDescription(in); err == nil {
+			t.Errorf("splitDescription(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestSnapshotVersion(t *testing.T) {
+	// The date is converted to UTC, in which it is already the 5th.
+	date := time.Date(2013, 6, 4, 23, 30, 0, 0, time.FixedZone("", -3600))
+	tests := []struct {
+		name string
+		d    vcsDescription
+		want string
+	}{
+		{"git", vcsDescription{"v1.2.0", 0, "gabc1234", date, false}, "1.2.0"},
+		{"git", vcsDescription{"V1.2.0", 0, "gabc1234", date, false}, "1.2.0"},
+		{
+			"git", vcsDescription{"v1.2.0", 5, "gabc1234", date, false},
+			"1.2.0+git20130605.5.gabc1234",
+		},
+		{
+			"git", vcsDescription{"v1.2.0", 0, "gabc1234", date, true},
+			"1.2.0+git20130605.0.gabc1234.dirty",
+		},
+		{
+			"git", vcsDescription{"v1.2.0-rc1", 2, "gabc1234", date, false},
+			"1.2.0-rc1+git20130605.2.gabc1234",
+		},
+		{
+			"git", vcsDescription{"", 17, "gabc1234", date, false},
+			"0~git20130605.17.gabc1234",
+		},
+		{
+			"hg", vcsDescription{"", 17, "0123456789ab", date, true},
+			"0~hg20130605.17.0123456789ab.dirty",
+		},
+	}
+	for _, test := range tests {
+		version := snapshotVersion(test.name, &test.d)
+		if version != test.want {
+			t.Errorf("snapshotVersion(%q, %+v) = %q, want %q",
+				test.name, test.d, version, test.want)
+		}
+	}
+}